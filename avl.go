@@ -24,7 +24,7 @@ func predicateOnPortID(userRef any, node *TreeNode) int8 {
 
 func predicateOnStruct(userRef any, node *TreeNode) int8 {
 	port := userRef.(*Sub).port
-	return predicateOnPortID(port, node)
+	return predicateOnPortID(&port, node)
 }
 
 func predicateTx(userRef any, node *TreeNode) int8 {
@@ -34,8 +34,11 @@ func predicateTx(userRef any, node *TreeNode) int8 {
 		target = (*TxQueueItem)(unsafe.Pointer(targetNode))
 	}
 	other := (*TxQueueItem)(unsafe.Pointer(node))
-	sign := bsign(target.frame.extendedCANID >= other.frame.extendedCANID)
-	return sign
+	if target.frame.extendedCANID != other.frame.extendedCANID {
+		return bsign(target.frame.extendedCANID > other.frame.extendedCANID)
+	}
+	// Frames with equal CAN ID are transmitted in the order they were pushed.
+	return bsign(target.seq > other.seq)
 }
 
 func search(root **TreeNode, userRef any, predicate func(any, *TreeNode) int8, factory func(any) *TreeNode) (*TreeNode, error) {
@@ -117,7 +120,7 @@ func adjustBalance(x *TreeNode, increment bool) *TreeNode {
 	if !increment {
 		newBf -= 2
 	}
-	if newBf >= -1 || newBf <= 1 {
+	if newBf >= -1 && newBf <= 1 {
 		x.bf = newBf // Balancing not needed, just update the balance factor and call it a day.
 		return out
 	}
@@ -192,6 +195,17 @@ func findExtremum(root *TreeNode, max bool) *TreeNode {
 	return result
 }
 
+// successor returns the node following n in order, or nil if n is the last node.
+func successor(n *TreeNode) *TreeNode {
+	if n.lr[1] != nil {
+		return findExtremum(n.lr[1], false)
+	}
+	for n.up != nil && n.up.lr[1] == n {
+		n = n.up
+	}
+	return n.up
+}
+
 func remove(root **TreeNode, node *TreeNode) {
 	if root == nil || node == nil {
 		return
@@ -205,7 +219,7 @@ func remove(root **TreeNode, node *TreeNode) {
 	// Balancing is not performed yet so we may end up with an unbalanced tree.
 	if node.lr[0] != nil && node.lr[1] != nil {
 		re := findExtremum(node.lr[1], false)
-		if re == nil || re.lr[0] == nil || re.up == nil {
+		if re == nil || re.lr[0] != nil || re.up == nil {
 			panic("invalid re extremum")
 		}
 		re.bf = node.bf
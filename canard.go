@@ -7,17 +7,24 @@ import (
 type Instance struct {
 	// userRef any
 	NodeID NodeID
+	// Memory allocates received transfer payloads. If nil the Go heap is used.
+	Memory MemoryResource
 	// There are 3 kinds of transfer modes.
 	rxSub [3]*TreeNode
+	// Default memory resource.
+	heap heapMemory
+	// Sessions and bytes freed by CleanupSessions and Unsubscribe.
+	reclaimedSessions int
+	reclaimedBytes    int
 }
 
-const _MTU = 64
-
-type microsecond uint64
+// Microsecond is a timestamp or duration expressed in microseconds.
+// The time system may be arbitrary as long as the clock is monotonic (steady).
+type Microsecond uint64
 
 type TxItem struct {
 	base          TxQueueItem
-	payloadBuffer [_MTU]byte
+	payloadBuffer []byte
 }
 
 // Tail is the last byte of the payload and contains transfer
@@ -43,17 +50,32 @@ type TxQueue struct {
 	//
 	// Valid values are any valid CAN frame data length value not smaller than 8.
 	// Invalid values are treated as the nearest valid value. The default is the maximum valid value.
-	MTU  int
-	size int
-	root *TreeNode
+	MTU int
+	// Memory allocates frame data. If nil the Go heap is used. Memory does not hold
+	// the queue's items, which are allocated on the Go heap when no freed item is
+	// available for reuse, unless preallocated with Reserve.
+	Memory MemoryResource
+	size   int
+	root   *TreeNode
+	// Insertion sequence number of the last frame pushed.
+	seq uint64
+	// Items freed by the user, linked by nextInTx, available for reuse.
+	spare    *TxItem
+	numSpare int
+	// Set by Reserve, items are not allocated when spare is exhausted.
+	reserved bool
+	// Default memory resource.
+	heap heapMemory
 	// userRef any
 }
 type TxQueueItem struct {
 	// Must be first field due to use of unsafe.
 	base     TreeNode
 	nextInTx *TxQueueItem
-	deadline microsecond
+	deadline Microsecond
 	frame    Frame
+	// Insertion sequence number. Orders frames with equal CAN ID.
+	seq uint64
 }
 
 func (t *TxQueueItem) TailByte() Tail {
@@ -74,12 +96,49 @@ func (t *TxQueueItem) CRC() (CRC, error) {
 		CRC(t.frame.payload[t.frame.payloadSize-2]), nil
 }
 
+// Deadline returns the time after which the frame should no longer be transmitted.
+func (t *TxQueueItem) Deadline() Microsecond { return t.deadline }
+
+// Frame returns the CAN frame held by the queue item. The frame data
+// references the item's buffer.
+func (t *TxQueueItem) Frame() Frame { return t.frame }
+
+// Frame is a CAN data frame with an extended 29 bit identifier.
 type Frame struct {
 	extendedCANID uint32
 	payloadSize   int
 	payload       []byte
 }
 
+// NewFrame creates a frame with an extended CAN ID and data. data is not copied.
+// The length of data must be a valid CAN DLC length, this is
+// 0..8, 12, 16, 20, 24, 32, 48 or 64.
+func NewFrame(extendedCANID uint32, data []byte) (Frame, error) {
+	switch {
+	case extendedCANID > _CAN_EXT_ID_MASK:
+		return Frame{}, ErrInvalidCANID
+	case len(data) > _MTU_MAX || int(canDLCToLength[canLengthToDLC[len(data)]]) != len(data):
+		return Frame{}, ErrInvalidDLC
+	}
+	return Frame{
+		extendedCANID: extendedCANID,
+		payloadSize:   len(data),
+		payload:       data,
+	}, nil
+}
+
+// ID returns the extended CAN ID of the frame.
+func (f Frame) ID() uint32 { return f.extendedCANID }
+
+// DLC returns the Data Length Code of the frame. Values above 8 are only valid for CAN FD frames.
+func (f Frame) DLC() uint8 { return canLengthToDLC[f.payloadSize] }
+
+// Data returns the frame's data, which includes the tail byte.
+func (f Frame) Data() []byte { return f.payload[:f.payloadSize] }
+
+// IsFD returns true if the frame's data does not fit in a classic CAN frame.
+func (f Frame) IsFD() bool { return f.payloadSize > _MTU_CAN_CLASSIC }
+
 type NodeID uint8
 
 //go:inline
@@ -103,12 +162,14 @@ type TID uint8
 
 // / High-level transport frame model.
 type FrameModel struct {
-	timestamp   microsecond
-	prority     Priority
-	txKind      TxKind
-	port        PortID
-	srcNode     NodeID
-	dstNode     NodeID
+	timestamp Microsecond
+	prority   Priority
+	txKind    TxKind
+	port      PortID
+	srcNode   NodeID
+	dstNode   NodeID
+	// Source field of anonymous frames.
+	pseudoID    NodeID
 	tid         TID
 	txStart     bool
 	txEnd       bool
@@ -125,18 +186,29 @@ func (tx *Metadata) fromRxFrame(frame *FrameModel) {
 	tx.TID = frame.tid
 }
 
-const nodemax = 127
-
 type Sub struct {
 	// must be first field due to use of unsafe.
 	base       TreeNode
-	tidTimeout microsecond
+	tidTimeout Microsecond
 	extent     int
 	port       PortID
-	userRef    interface{}
-	sessions   [nodemax]*internalRxSession
+	// Holds the subscription's Handler.
+	userRef  interface{}
+	sessions [NODE_ID_MAX + 1]*internalRxSession
 }
 
+// Handler is called by Instance.Accept with each transfer received on a subscription.
+// The transfer is only valid for the duration of the call, though its payload
+// remains owned by the caller of Accept.
+type Handler func(sub *Sub, tx *Transfer)
+
+// SetHandler sets the function called with each transfer received on the subscription.
+// A nil handler disables dispatch.
+func (s *Sub) SetHandler(h Handler) { s.userRef = h }
+
+// Port returns the subject or service ID of the subscription.
+func (s *Sub) Port() PortID { return s.port }
+
 type Metadata struct {
 	Priority Priority
 	TxKind   TxKind
@@ -149,11 +221,36 @@ type Transfer struct {
 	metadata Metadata
 	// The timestamp of the first received CAN frame of this transfer.
 	// The time system may be arbitrary as long as the clock is monotonic (steady).
-	timestamp   microsecond
+	timestamp   Microsecond
 	payloadSize int
 	payload     []byte
+	// Pseudo node ID of anonymous transfers.
+	pseudoID NodeID
+	// Destination node of service transfers.
+	dst NodeID
 }
 
+// Metadata returns the transfer metadata. For received transfers Remote is the source node.
+func (t *Transfer) Metadata() Metadata { return t.metadata }
+
+// Timestamp returns the reception timestamp of the first frame of the transfer.
+func (t *Transfer) Timestamp() Microsecond { return t.timestamp }
+
+// PseudoNodeID returns the pseudo node ID of an anonymous transfer, which is
+// derived from the payload by the sender and used to tell anonymous nodes apart.
+// ok is false if the transfer is not anonymous.
+func (t *Transfer) PseudoNodeID() (id NodeID, ok bool) {
+	return t.pseudoID, t.metadata.Remote.IsUnset()
+}
+
+// Destination returns the destination node of a service transfer. Messages have
+// no destination and return an unset node ID.
+func (t *Transfer) Destination() NodeID { return t.dst }
+
+// Payload returns the transfer payload. The payload buffer is owned by the
+// caller until it is handed back with Instance.Release.
+func (t *Transfer) Payload() []byte { return t.payload[:t.payloadSize] }
+
 // ecID represents an extended CAN ID.
 type ecID uint32
 
@@ -174,12 +271,14 @@ func (can ecID) PortID() PortID {
 
 func (m *Metadata) makeCANID(payloadSize int, payload []byte, local NodeID, presentationLayerMTU int) (uint32, error) {
 	switch {
-	case presentationLayerMTU <= 0:
+	case presentationLayerMTU <= 0 || payloadSize < 0:
 		return 0, ErrInvalidArgument
 	case len(payload) == 0 && payloadSize != 0:
 		return 0, errEmptyPayload
 	case len(payload) < payloadSize:
-		panic("OOM payload TODO")
+		return 0, ErrInvalidArgument
+	case m.TxKind >= numberOfTxKinds:
+		return 0, ErrTransferKind
 	}
 	var out uint32
 	if m.TxKind == TxKindMessage && m.Remote.IsUnset() && m.Port <= SUBJECT_ID_MAX {
@@ -189,7 +288,7 @@ func (m *Metadata) makeCANID(payloadSize int, payload []byte, local NodeID, pres
 			c := newNodeID(payload[:payloadSize])
 			out = makeMessageSessionSpecifier(m.Port, c) | FLAG_ANONYMOUS_MESSAGE
 			if out > _CAN_EXT_ID_MASK {
-				panic("spec > can_ext_id_mask TODO")
+				return 0, ErrInvalidCANID
 			}
 		} else {
 			return 0, ErrInvalidArgument
@@ -201,7 +300,8 @@ func (m *Metadata) makeCANID(payloadSize int, payload []byte, local NodeID, pres
 		out = makeServiceSessionSpecifier(m.Port, m.TxKind, local, m.Remote)
 	}
 	if out == 0 {
-		panic("Invalid arg or undefined behaviour")
+		// Metadata does not describe a valid message or service transfer.
+		return 0, ErrInvalidArgument
 	}
 	prio := m.Priority
 	if prio >= numOfPriorities {
@@ -0,0 +1,71 @@
+package canard
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNewFrame(t *testing.T) {
+	const canID = 0b001_00_0_11_0110011001100_0_0100111
+	for length := 0; length <= _MTU_MAX+1; length++ {
+		data := make([]byte, length)
+		frame, err := NewFrame(canID, data)
+		validLength := length <= _MTU_MAX && int(canDLCToLength[canLengthToDLC[length]]) == length
+		if !validLength {
+			if !errors.Is(err, ErrInvalidDLC) {
+				t.Errorf("length %d: expected ErrInvalidDLC, got %v", length, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("length %d: %v", length, err)
+		}
+		if frame.ID() != canID {
+			t.Errorf("length %d: got CAN ID %#x, want %#x", length, frame.ID(), canID)
+		}
+		if len(frame.Data()) != length {
+			t.Errorf("length %d: got data length %d", length, len(frame.Data()))
+		}
+		if canDLCToLength[frame.DLC()] != uint8(length) {
+			t.Errorf("length %d: bad DLC %d", length, frame.DLC())
+		}
+		if frame.IsFD() != (length > _MTU_CAN_CLASSIC) {
+			t.Errorf("length %d: bad FD flag", length)
+		}
+	}
+	_, err := NewFrame(_CAN_EXT_ID_MASK+1, []byte{tailByte(true, true, true, 0)})
+	if !errors.Is(err, ErrInvalidCANID) {
+		t.Error("expected ErrInvalidCANID, got", err)
+	}
+}
+
+func TestTxQueueItemFrame(t *testing.T) {
+	que := TxQueue{Cap: 1, MTU: _MTU_CAN_CLASSIC}
+	meta := Metadata{
+		Priority: PriorityNominal,
+		TxKind:   TxKindMessage,
+		Port:     321,
+		Remote:   0xff,
+		TID:      3,
+	}
+	const deadline = 1e6
+	err := que.Push(42, deadline, &meta, 3, []byte{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	item := que.Peek()
+	if item.Deadline() != deadline {
+		t.Error("bad deadline", item.Deadline())
+	}
+	frame := item.Frame()
+	if ecID(frame.ID()).PortID() != meta.Port || ecID(frame.ID()).Source() != 42 {
+		t.Errorf("bad CAN ID %#x", frame.ID())
+	}
+	data := frame.Data()
+	if len(data) != 4 || data[0] != 1 || data[1] != 2 || data[2] != 3 {
+		t.Error("bad frame data", data)
+	}
+	if data[3] != tailByte(true, true, true, meta.TID) {
+		t.Errorf("bad tail byte %b", data[3])
+	}
+}
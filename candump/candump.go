@@ -0,0 +1,200 @@
+// Package candump reads and writes CAN frames in the log file format of
+// candump -l from Linux can-utils. Each line of the log holds a timestamp,
+// an interface name and a frame:
+//
+//	(1436509052.249713) can0 107D552A#0102E0
+//	(1436509052.250018) can0 107D552A##1000102030405060708090A0B0C0D0EE0
+//
+// Classic frames separate the CAN ID and data with a single #.
+// FD frames separate them with ## followed by a hex digit of FD flags.
+package candump
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	canard "github.com/soypat/go-canard"
+)
+
+// ErrSyntax is returned by Reader.Read for malformed log lines.
+var ErrSyntax = errors.New("candump: invalid log line")
+
+// FD flags of a frame logged in the ## form.
+const (
+	flagBRS = 0x1
+)
+
+// Record is a frame logged on an interface at a timestamp given in
+// microseconds since the Unix epoch.
+type Record struct {
+	Timestamp canard.Microsecond
+	Interface string
+	Frame     canard.Frame
+}
+
+// Reader reads records from a candump log.
+type Reader struct {
+	s    *bufio.Scanner
+	line int
+}
+
+// NewReader returns a Reader of the log in r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{s: bufio.NewScanner(r)}
+}
+
+// Read returns the next extended data frame in the log. Blank lines and lines with standard,
+// remote or error frames are skipped. It returns io.EOF at the end of the log and an error
+// wrapping ErrSyntax if a line is malformed.
+func (r *Reader) Read() (Record, error) {
+	for r.s.Scan() {
+		r.line++
+		line := strings.TrimSpace(r.s.Text())
+		if line == "" {
+			continue
+		}
+		rec, ok, err := parseLine(line)
+		if err != nil {
+			return Record{}, fmt.Errorf("line %d: %w", r.line, err)
+		}
+		if ok {
+			return rec, nil
+		}
+	}
+	if err := r.s.Err(); err != nil {
+		return Record{}, err
+	}
+	return Record{}, io.EOF
+}
+
+// parseLine parses a log line. ok is false if the line does not hold an extended data frame.
+func parseLine(line string) (rec Record, ok bool, err error) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 || len(fields[0]) < 3 || fields[0][0] != '(' || fields[0][len(fields[0])-1] != ')' {
+		return rec, false, ErrSyntax
+	}
+	rec.Timestamp, err = parseTimestamp(fields[0][1 : len(fields[0])-1])
+	if err != nil {
+		return rec, false, err
+	}
+	rec.Interface = fields[1]
+	id, data, found := strings.Cut(fields[2], "#")
+	if !found {
+		return rec, false, ErrSyntax
+	}
+	if strings.HasPrefix(data, "#") {
+		// FD frame, skip flags.
+		if len(data) < 2 {
+			return rec, false, ErrSyntax
+		}
+		data = data[2:]
+	} else if strings.HasPrefix(data, "R") {
+		return rec, false, nil // Remote frame.
+	}
+	canID, err := strconv.ParseUint(id, 16, 32)
+	if err != nil {
+		return rec, false, ErrSyntax
+	}
+	if len(id) != 8 || canID > 0x1fffffff {
+		return rec, false, nil // Standard or error frame.
+	}
+	if len(data)%2 != 0 {
+		return rec, false, ErrSyntax
+	}
+	buf := make([]byte, len(data)/2)
+	for i := range buf {
+		b, err := strconv.ParseUint(data[2*i:2*i+2], 16, 8)
+		if err != nil {
+			return rec, false, ErrSyntax
+		}
+		buf[i] = byte(b)
+	}
+	rec.Frame, err = canard.NewFrame(uint32(canID), buf)
+	if err != nil {
+		// Data length is not a valid CAN length.
+		return rec, false, fmt.Errorf("%w: %v", ErrSyntax, err)
+	}
+	return rec, true, nil
+}
+
+// parseTimestamp parses seconds with a fractional part into microseconds.
+func parseTimestamp(s string) (canard.Microsecond, error) {
+	secStr, fracStr, _ := strings.Cut(s, ".")
+	sec, err := strconv.ParseUint(secStr, 10, 63)
+	if err != nil {
+		return 0, ErrSyntax
+	}
+	var usec uint64
+	if fracStr != "" {
+		// Keep microsecond precision.
+		if len(fracStr) > 6 {
+			fracStr = fracStr[:6]
+		}
+		usec, err = strconv.ParseUint(fracStr, 10, 32)
+		if err != nil {
+			return 0, ErrSyntax
+		}
+		for i := len(fracStr); i < 6; i++ {
+			usec *= 10
+		}
+	}
+	return canard.Microsecond(sec*1e6 + usec), nil
+}
+
+// Writer writes frames in the candump log format.
+type Writer struct {
+	// Interface is the interface name written with each frame.
+	Interface string
+	// BitrateSwitch sets whether FD frames are logged with the bitrate switch flag.
+	BitrateSwitch bool
+	w             io.Writer
+	buf           []byte
+}
+
+// NewWriter returns a Writer of frames logged on iface to w.
+func NewWriter(w io.Writer, iface string) *Writer {
+	return &Writer{w: w, Interface: iface}
+}
+
+// Write writes a log line of frame at timestamp in microseconds since the Unix epoch.
+func (w *Writer) Write(timestamp canard.Microsecond, frame canard.Frame) error {
+	const hexDigits = "0123456789ABCDEF"
+	b := w.buf[:0]
+	b = append(b, '(')
+	b = append(b, fmt.Sprintf("%010d.%06d", timestamp/1e6, timestamp%1e6)...)
+	b = append(b, ") "...)
+	b = append(b, w.Interface...)
+	b = append(b, fmt.Sprintf(" %08X#", frame.ID())...)
+	if frame.IsFD() {
+		var flags byte
+		if w.BitrateSwitch {
+			flags |= flagBRS
+		}
+		b = append(b, '#', hexDigits[flags])
+	}
+	for _, c := range frame.Data() {
+		b = append(b, hexDigits[c>>4], hexDigits[c&0xf])
+	}
+	b = append(b, '\n')
+	w.buf = b
+	_, err := w.w.Write(b)
+	return err
+}
+
+// WriteQueue pops all frames from q in transmission order and writes them at timestamp.
+// Written frames are freed. It returns the number of frames written.
+func (w *Writer) WriteQueue(timestamp canard.Microsecond, q *canard.TxQueue) (n int, err error) {
+	for item := q.Peek(); item != nil; item = q.Peek() {
+		err = w.Write(timestamp, item.Frame())
+		if err != nil {
+			return n, err
+		}
+		q.Free(q.Pop(item))
+		n++
+	}
+	return n, nil
+}
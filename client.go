@@ -0,0 +1,155 @@
+package canard
+
+import "errors"
+
+// Client calls a service on remote servers and matches responses to requests.
+type Client struct {
+	// OnError, if set, is called with responses dispatched by Instance.Accept which
+	// HandleResponse rejected and the error it returned, such as ErrUnexpectedResponse.
+	// Late responses are reported to the call's callback instead.
+	OnError  func(resp *Transfer, err error)
+	ins      *Instance
+	q        *TxQueue
+	service  PortID
+	priority Priority
+	timeout  Microsecond
+	sub      Sub
+	// Transfer-ID of next request to each server.
+	tids    [NODE_ID_MAX + 1]TID
+	pending map[callKey]call
+	failed  int
+}
+
+// callKey identifies an outstanding call. Per the Cyphal specification
+// a response carries the transfer-ID of its request.
+type callKey struct {
+	server  NodeID
+	service PortID
+	tid     TID
+}
+
+type call struct {
+	deadline Microsecond
+	callback func(resp *Transfer, err error)
+}
+
+// NewClient creates a Client of service which subscribes to the service's responses on
+// ins, receiving up to extent bytes of response payload. Requests are pushed to q with
+// priority and must be responded to within timeout. The instance's node ID must be set.
+// Responses received by Instance.Accept are dispatched to HandleResponse.
+func NewClient(ins *Instance, q *TxQueue, service PortID, extent int, priority Priority, timeout Microsecond) (*Client, error) {
+	switch {
+	case ins == nil || q == nil:
+		return nil, ErrInvalidArgument
+	case service > SERVICE_ID_MAX || priority >= numOfPriorities:
+		return nil, ErrInvalidArgument
+	case !ins.NodeID.IsSet():
+		return nil, ErrInvalidNodeID
+	}
+	c := &Client{
+		ins:      ins,
+		q:        q,
+		service:  service,
+		priority: priority,
+		timeout:  timeout,
+		pending:  make(map[callKey]call),
+	}
+	err := ins.Subscribe(TxKindResponse, service, extent, timeout, &c.sub)
+	if err != nil {
+		return nil, err
+	}
+	c.sub.SetHandler(func(_ *Sub, resp *Transfer) {
+		err := c.HandleResponse(resp)
+		if err != nil && !errors.Is(err, ErrCallTimeout) {
+			c.failed++
+			if c.OnError != nil {
+				c.OnError(resp, err)
+			}
+		}
+	})
+	return c, nil
+}
+
+// Request pushes a request with payload to server. callback is called by HandleResponse
+// with the matching response, or with ErrCallTimeout if no response is received within
+// the client's timeout. It returns the transfer-ID of the request.
+func (c *Client) Request(now Microsecond, server NodeID, payload []byte, callback func(resp *Transfer, err error)) (TID, error) {
+	switch {
+	case !server.IsSet():
+		return 0, ErrInvalidNodeID
+	case callback == nil:
+		return 0, ErrInvalidArgument
+	}
+	key := callKey{server: server, service: c.service, tid: c.tids[server]}
+	if _, ok := c.pending[key]; ok {
+		// All transfer-IDs of server are in use.
+		return 0, ErrCallPending
+	}
+	meta := Metadata{
+		Priority: c.priority,
+		TxKind:   TxKindRequest,
+		Port:     c.service,
+		Remote:   server,
+		TID:      key.tid,
+	}
+	deadline := now + c.timeout
+	err := c.q.Push(c.ins.NodeID, deadline, &meta, len(payload), payload)
+	if err != nil {
+		return 0, err
+	}
+	c.tids[server] = (key.tid + 1) & TRANSFER_ID_MAX
+	c.pending[key] = call{deadline: deadline, callback: callback}
+	return key.tid, nil
+}
+
+// HandleResponse delivers a response received on the client's subscription to its call.
+// It returns ErrUnexpectedResponse if the response does not match an outstanding call,
+// i.e. it comes from a node that was not called. If the response arrived after the
+// call's deadline the call's callback receives ErrCallTimeout instead.
+func (c *Client) HandleResponse(resp *Transfer) error {
+	if resp == nil {
+		return ErrInvalidArgument
+	}
+	meta := resp.metadata
+	if meta.TxKind != TxKindResponse {
+		return ErrUnexpectedResponse
+	}
+	key := callKey{server: meta.Remote, service: meta.Port, tid: meta.TID}
+	pending, ok := c.pending[key]
+	if !ok {
+		return ErrUnexpectedResponse
+	}
+	delete(c.pending, key)
+	if resp.timestamp > pending.deadline {
+		pending.callback(nil, ErrCallTimeout)
+		return ErrCallTimeout
+	}
+	pending.callback(resp, nil)
+	return nil
+}
+
+// Failed returns the number of responses dispatched by Instance.Accept which HandleResponse rejected.
+func (c *Client) Failed() int { return c.failed }
+
+// Poll calls the callbacks of outstanding calls whose deadline passed before now
+// with ErrCallTimeout. It returns the number of calls timed out.
+func (c *Client) Poll(now Microsecond) (timedOut int) {
+	for key, pending := range c.pending {
+		if pending.deadline < now {
+			delete(c.pending, key)
+			pending.callback(nil, ErrCallTimeout)
+			timedOut++
+		}
+	}
+	return timedOut
+}
+
+// Pending returns the number of outstanding calls.
+func (c *Client) Pending() int { return len(c.pending) }
+
+// Close unsubscribes the client from the service's responses.
+// Outstanding calls are dropped without calling their callbacks.
+func (c *Client) Close() error {
+	c.pending = make(map[callKey]call)
+	return c.ins.Unsubscribe(TxKindResponse, c.service)
+}
@@ -0,0 +1,143 @@
+package canard
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestClient(t *testing.T) {
+	const (
+		service = 123
+		timeout = 1000
+		server  = 10
+		other   = 11
+	)
+	clientIns := &Instance{NodeID: 20}
+	clientQue := &TxQueue{Cap: 64, MTU: _MTU_CAN_CLASSIC}
+	client, err := NewClient(clientIns, clientQue, service, 64, PriorityHigh, timeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverIns := &Instance{NodeID: server}
+	serverQue := &TxQueue{Cap: 64, MTU: _MTU_CAN_CLASSIC}
+	err = serverIns.Subscribe(TxKindRequest, service, 64, timeout, &Sub{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gotResp []byte
+	var gotErr error
+	callback := func(resp *Transfer, err error) {
+		gotErr = err
+		if resp != nil {
+			gotResp = append([]byte(nil), resp.Payload()...)
+		}
+	}
+	tid, err := client.Request(0, server, []byte("ping"), callback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reqs := transmit(t, clientQue, serverIns, 10)
+	if len(reqs) != 1 {
+		t.Fatal("expected a single request received, got", len(reqs))
+	}
+	req := reqs[0].Metadata()
+	if req.TxKind != TxKindRequest || req.Remote != clientIns.NodeID || req.TID != tid || req.Priority != PriorityHigh {
+		t.Errorf("bad request metadata %+v", req)
+	}
+	respond := func(ins *Instance, ts Microsecond, payload []byte) []Transfer {
+		t.Helper()
+		meta := req
+		meta.TxKind = TxKindResponse
+		err := serverQue.Push(ins.NodeID, ts+timeout, &meta, len(payload), payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return transmit(t, serverQue, clientIns, ts)
+	}
+
+	// Response from a node that was not called.
+	resps := respond(&Instance{NodeID: other}, 20, []byte("pong"))
+	if len(resps) != 1 {
+		t.Fatal("expected response received")
+	}
+	if gotResp != nil || gotErr != nil || client.Pending() != 1 {
+		t.Error("expected response from unexpected node to be ignored")
+	}
+	if client.Failed() != 1 {
+		t.Error("expected unexpected response dispatched by Accept to be counted, got", client.Failed())
+	}
+	err = client.HandleResponse(&resps[0])
+	if !errors.Is(err, ErrUnexpectedResponse) {
+		t.Error("expected unexpected response error, got", err)
+	}
+
+	// Response dispatched by Accept.
+	resps = respond(serverIns, 30, []byte("pong"))
+	if len(resps) != 1 || gotErr != nil {
+		t.Fatal("expected response", gotErr)
+	}
+	if string(gotResp) != "pong" {
+		t.Errorf("bad response %q", gotResp)
+	}
+	if client.Pending() != 0 {
+		t.Error("expected no pending calls")
+	}
+	// Duplicate response.
+	err = client.HandleResponse(&resps[0])
+	if !errors.Is(err, ErrUnexpectedResponse) {
+		t.Error("expected duplicate response to be unexpected, got", err)
+	}
+
+	// Timeout.
+	gotResp = nil
+	_, err = client.Request(100, server, []byte("ping"), callback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := client.Poll(100 + timeout); n != 0 {
+		t.Error("no calls expected to time out, got", n)
+	}
+	if n := client.Poll(100 + timeout + 1); n != 1 || !errors.Is(gotErr, ErrCallTimeout) || gotResp != nil {
+		t.Error("expected call to time out", n, gotErr)
+	}
+
+	// Transfer-IDs exhausted.
+	for i := 0; i <= TRANSFER_ID_MAX; i++ {
+		_, err = client.Request(200, server, nil, callback)
+		clientQue.Purge(Microsecond(^uint64(0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = client.Request(200, server, nil, callback)
+	if !errors.Is(err, ErrCallPending) {
+		t.Error("expected ErrCallPending, got", err)
+	}
+	err = client.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clientIns.GetSubs(TxKindResponse)) != 0 {
+		t.Error("expected client to unsubscribe on close")
+	}
+}
+
+// transmit pops all frames in q and accepts them on ins at timestamp ts.
+// It returns the transfers received.
+func transmit(t *testing.T, q *TxQueue, ins *Instance, ts Microsecond) (transfers []Transfer) {
+	t.Helper()
+	for q.Peek() != nil {
+		tqi := q.Pop(nil)
+		frame := tqi.Frame()
+		var transfer Transfer
+		_, err := ins.Accept(ts, &frame, 0, &transfer)
+		if err == nil {
+			transfers = append(transfers, transfer)
+		} else if !errors.Is(err, ErrTransferPending) {
+			t.Fatal(err)
+		}
+		q.Free(tqi)
+	}
+	return transfers
+}
@@ -0,0 +1,126 @@
+package canard
+
+import (
+	"errors"
+	"sync"
+)
+
+// Driver is a CAN interface able to transmit and receive frames.
+type Driver interface {
+	// Send transmits a frame that should be sent before deadline. The frame data
+	// must not be referenced after Send returns. If the frame cannot be accepted at
+	// the moment, i.e. the transmit mailbox is full, Send must return ErrDriverBusy.
+	Send(deadline Microsecond, frame Frame) error
+	// Receive returns the next frame received and its reception timestamp.
+	// The frame data is only valid until the next call to Receive.
+	// If there are no frames available Receive returns ErrNoFrame.
+	Receive() (Frame, Microsecond, error)
+}
+
+// Pump transmits queued frames through d in priority order until the queue is empty
+// or the driver is busy. Frames which the driver could not accept are left in the queue
+// to be retried on the next call. Expired frames and the remaining frames of their
+// transfers are dropped. Sent and dropped frames are freed. Pump returns the number
+// of frames sent and dropped.
+func (q *TxQueue) Pump(now Microsecond, d Driver) (sent, dropped int, err error) {
+	if q == nil || d == nil {
+		return 0, 0, ErrInvalidArgument
+	}
+	dropped, _ = q.Purge(now)
+	for tqi := q.Peek(); tqi != nil; tqi = q.Peek() {
+		err = d.Send(tqi.deadline, tqi.frame)
+		if errors.Is(err, ErrDriverBusy) {
+			break
+		} else if err != nil {
+			return sent, dropped, err
+		}
+		q.Free(q.Pop(tqi))
+		sent++
+	}
+	return sent, dropped, nil
+}
+
+// MemDriver is an in-memory Driver. Frames sent are held in a transmit
+// mailbox until retrieved with Transmit and frames to be received
+// are queued with Inject. The zero value has no mailbox and is always busy.
+// MemDriver is safe for concurrent use.
+type MemDriver struct {
+	// MailboxSize is the number of sent frames held before Send returns ErrDriverBusy.
+	MailboxSize int
+	mu          sync.Mutex
+	tx          []memFrame
+	rx          []memFrame
+	// Holds data of last received frame.
+	rxBuf memFrame
+}
+
+type memFrame struct {
+	// Deadline of frames sent or timestamp of frames received.
+	time Microsecond
+	id   uint32
+	size int
+	data [_MTU_MAX]byte
+}
+
+func newMemFrame(time Microsecond, frame Frame) memFrame {
+	mf := memFrame{
+		time: time,
+		id:   frame.extendedCANID,
+		size: frame.payloadSize,
+	}
+	copy(mf.data[:], frame.Data())
+	return mf
+}
+
+// Send copies the frame into the transmit mailbox. It returns ErrDriverBusy if the mailbox is full.
+func (d *MemDriver) Send(deadline Microsecond, frame Frame) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.tx) >= d.MailboxSize {
+		return ErrDriverBusy
+	}
+	d.tx = append(d.tx, newMemFrame(deadline, frame))
+	return nil
+}
+
+// Receive returns the oldest frame injected or ErrNoFrame if there are none.
+func (d *MemDriver) Receive() (Frame, Microsecond, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.rx) == 0 {
+		return Frame{}, 0, ErrNoFrame
+	}
+	d.rxBuf = d.rx[0]
+	d.rx = d.rx[1:]
+	return d.rxBuf.frame(), d.rxBuf.time, nil
+}
+
+// Inject copies a frame into the receive queue to be returned by Receive.
+func (d *MemDriver) Inject(timestamp Microsecond, frame Frame) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.rx = append(d.rx, newMemFrame(timestamp, frame))
+}
+
+// Transmit removes the oldest frame in the transmit mailbox, freeing space for a new frame
+// as if it were sent on the bus. The returned frame data is owned by the caller.
+func (d *MemDriver) Transmit() (frame Frame, deadline Microsecond, ok bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.tx) == 0 {
+		return Frame{}, 0, false
+	}
+	mf := d.tx[0]
+	d.tx = d.tx[1:]
+	frame = mf.frame()
+	frame.payload = append([]byte(nil), frame.payload...)
+	return frame, mf.time, true
+}
+
+func (mf *memFrame) frame() Frame {
+	return Frame{
+		extendedCANID: mf.id,
+		payloadSize:   mf.size,
+		payload:       mf.data[:mf.size],
+	}
+}
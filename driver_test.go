@@ -0,0 +1,75 @@
+package canard
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTxQueuePump(t *testing.T) {
+	const (
+		port = 0xccc
+		src  = 42
+		now  = 100
+	)
+	que := TxQueue{Cap: 64, MTU: _MTU_CAN_CLASSIC}
+	payload := []byte("the quick brown fox jumps")
+	meta := Metadata{
+		Priority: PriorityNominal,
+		TxKind:   TxKindMessage,
+		Port:     port,
+		Remote:   0xff,
+		TID:      1,
+	}
+	err := que.Push(src, now+1000, &meta, len(payload), payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Expired transfer.
+	meta.TID++
+	meta.Priority = PriorityHigh
+	err = que.Push(src, now-1, &meta, len(payload), payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ins, transfer, sub, _ := newInstanceHelper()
+	err = ins.Subscribe(TxKindMessage, port, 64, 1e6, sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	drv := MemDriver{MailboxSize: 2}
+	rx := MemDriver{}
+	const wantFrames = 4
+	totalSent := 0
+	for i := 0; que.Peek() != nil; i++ {
+		sent, dropped, err := que.Pump(now, &drv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 && dropped != wantFrames {
+			t.Error("expected expired transfer dropped, got", dropped)
+		} else if i > 0 && dropped != 0 {
+			t.Error("no frames expected to be dropped, got", dropped)
+		}
+		if sent > drv.MailboxSize {
+			t.Fatal("sent more frames than mailbox size", sent)
+		}
+		totalSent += sent
+		// Simulate bus.
+		for frame, _, ok := drv.Transmit(); ok; frame, _, ok = drv.Transmit() {
+			rx.Inject(now, frame)
+		}
+	}
+	if totalSent != wantFrames {
+		t.Error("expected all frames of live transfer sent, got", totalSent)
+	}
+	for frame, ts, err := rx.Receive(); !errors.Is(err, ErrNoFrame); frame, ts, err = rx.Receive() {
+		_, err = ins.Accept(ts, &frame, 0, transfer)
+		if err != nil && !errors.Is(err, ErrTransferPending) {
+			t.Fatal(err)
+		}
+	}
+	if transfer.metadata.TID != 1 || string(transfer.payload[:transfer.payloadSize]) != string(payload) {
+		t.Errorf("bad transfer received: %+v", transfer)
+	}
+}
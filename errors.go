@@ -13,9 +13,37 @@ var (
 	ErrInvalidNodeID   = errors.New("node id must be in 0.." + strconv.FormatUint(NODE_ID_MAX, 10))
 	ErrNoMatchingSub   = errors.New("no matching subscription")
 	ErrBadTransferID   = errors.New("transfer id must be in 0.." + strconv.FormatUint(TRANSFER_ID_MAX, 10))
-	errTODO            = errors.New("go-canard: generic error")
 	ErrTransferKind    = errors.New("undefined transfer kind")
+	ErrInvalidCANID    = errors.New("CAN ID exceeds 29 bits")
+	ErrInvalidDLC      = errors.New("frame data length is not a valid CAN DLC length")
+	ErrTxQueueFull     = errors.New("tx queue capacity exceeded")
+	ErrDriverBusy      = errors.New("driver busy")
+	ErrNoFrame         = errors.New("no frame available")
+	ErrOutOfMemory     = errors.New("out of memory")
+	ErrNodeClosed      = errors.New("node closed")
 
 	ErrAVLNodeNotFound = errors.New("avl: node not found")
 	ErrAVLNilRoot      = errors.New("avl: nil root")
 )
+
+// Errors returned by Instance.Accept when a valid frame did not complete a transfer.
+// Accept returns a nil error only when a transfer has been received.
+var (
+	// ErrTransferPending means the frame was accepted and stored but the transfer is not yet complete.
+	ErrTransferPending = errors.New("frame accepted, transfer incomplete")
+	// ErrDuplicateFrame means the frame belongs to an already received transfer or
+	// to a transfer being received over another redundant interface.
+	ErrDuplicateFrame = errors.New("duplicate frame")
+	// ErrMissedStart means the frame belongs to a transfer whose first frame was not received.
+	ErrMissedStart    = errors.New("missed start of transfer")
+	ErrTIDMismatch    = errors.New("unexpected transfer id")
+	ErrToggleMismatch = errors.New("unexpected toggle bit")
+	ErrCRCMismatch    = errors.New("transfer CRC mismatch")
+)
+
+// Errors returned by service clients.
+var (
+	ErrCallTimeout        = errors.New("service call timed out")
+	ErrCallPending        = errors.New("all transfer-IDs of server in use by outstanding calls")
+	ErrUnexpectedResponse = errors.New("response does not match an outstanding call")
+)
@@ -0,0 +1,102 @@
+package canard
+
+import (
+	"math/bits"
+	"unsafe"
+)
+
+// Filter is a hardware acceptance filter. A frame is accepted if
+// the bits of its CAN ID selected by Mask are equal to those of ID.
+type Filter struct {
+	ID   uint32
+	Mask uint32
+}
+
+// FilterForSubject returns a filter which accepts all messages of a subject.
+func FilterForSubject(subject PortID) Filter {
+	return Filter{
+		ID:   uint32(subject) << offset_SubjectID,
+		Mask: FLAG_SERVICE_NOT_MESSAGE | FLAG_RESERVED_07 | SUBJECT_ID_MAX<<offset_SubjectID,
+	}
+}
+
+// FilterForService returns a filter which accepts all requests and responses
+// of a service addressed to the local node.
+func FilterForService(service PortID, local NodeID) Filter {
+	return Filter{
+		ID:   FLAG_SERVICE_NOT_MESSAGE | uint32(service)<<offset_ServiceID | uint32(local)<<offset_DstNodeID,
+		Mask: FLAG_SERVICE_NOT_MESSAGE | FLAG_RESERVED_23 | SERVICE_ID_MAX<<offset_ServiceID | NODE_ID_MAX<<offset_DstNodeID,
+	}
+}
+
+// FilterForServices returns a filter which accepts all requests and responses addressed to the local node.
+func FilterForServices(local NodeID) Filter {
+	return Filter{
+		ID:   FLAG_SERVICE_NOT_MESSAGE | uint32(local)<<offset_DstNodeID,
+		Mask: FLAG_SERVICE_NOT_MESSAGE | FLAG_RESERVED_23 | NODE_ID_MAX<<offset_DstNodeID,
+	}
+}
+
+// ConsolidateFilters returns a filter which accepts all frames accepted by a and b.
+// It may accept frames accepted by neither.
+func ConsolidateFilters(a, b Filter) Filter {
+	mask := a.Mask & b.Mask &^ (a.ID ^ b.ID)
+	return Filter{
+		ID:   a.ID & mask,
+		Mask: mask,
+	}
+}
+
+// Match returns true if the filter accepts the CAN ID.
+func (f Filter) Match(extendedCANID uint32) bool {
+	return extendedCANID&f.Mask == f.ID&f.Mask
+}
+
+// accepted returns the number of different CAN IDs accepted by the filter.
+func (f Filter) accepted() int {
+	return 1 << (29 - bits.OnesCount32(f.Mask&_CAN_EXT_ID_MASK))
+}
+
+// consolidationCost returns an estimate of the number of CAN IDs accepted by
+// the consolidation of a and b which were not accepted by either.
+func consolidationCost(a, b Filter) int {
+	return ConsolidateFilters(a, b).accepted() - a.accepted() - b.accepted()
+}
+
+// Filters returns at most n filters which accept all frames of the instance's subscriptions.
+// Service subscriptions are only included if the instance's node ID is set.
+// When there are more subscriptions than filters, pairs of filters are consolidated greedily,
+// each time choosing the pair whose consolidation accepts the fewest CAN IDs.
+func (ins *Instance) Filters(n int) ([]Filter, error) {
+	if ins == nil || n < 1 {
+		return nil, ErrInvalidArgument
+	}
+	var filters []Filter
+	for kind := TxKind(0); kind < numberOfTxKinds; kind++ {
+		if ins.rxSub[kind] == nil || (kind != TxKindMessage && !ins.NodeID.IsSet()) {
+			continue
+		}
+		ins.rxSub[kind].traverse(0, func(node *TreeNode) {
+			sub := (*Sub)(unsafe.Pointer(node))
+			if kind == TxKindMessage {
+				filters = append(filters, FilterForSubject(sub.port))
+			} else {
+				filters = append(filters, FilterForService(sub.port, ins.NodeID))
+			}
+		})
+	}
+	for len(filters) > n {
+		bestI, bestJ, bestCost := 0, 1, -1
+		for i := 0; i < len(filters); i++ {
+			for j := i + 1; j < len(filters); j++ {
+				cost := consolidationCost(filters[i], filters[j])
+				if bestCost < 0 || cost < bestCost {
+					bestI, bestJ, bestCost = i, j, cost
+				}
+			}
+		}
+		filters[bestI] = ConsolidateFilters(filters[bestI], filters[bestJ])
+		filters = append(filters[:bestJ], filters[bestJ+1:]...)
+	}
+	return filters, nil
+}
@@ -0,0 +1,97 @@
+package canard
+
+import "testing"
+
+func TestFilters(t *testing.T) {
+	const local NodeID = 42
+	ins := &Instance{NodeID: local}
+	subjects := []PortID{10, 11, 12, 0x1000, SUBJECT_ID_MAX}
+	services := []PortID{1, 2, 3, SERVICE_ID_MAX}
+	for _, port := range subjects {
+		err := ins.Subscribe(TxKindMessage, port, 8, 1e6, &Sub{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, port := range services {
+		err := ins.Subscribe(TxKindRequest, port, 8, 1e6, &Sub{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	canID := func(meta Metadata, src NodeID) uint32 {
+		t.Helper()
+		id, err := meta.makeCANID(1, []byte{0}, src, 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	var accepted, rejected []uint32
+	for _, port := range subjects {
+		meta := Metadata{TxKind: TxKindMessage, Port: port, Remote: 0xff, Priority: PriorityLow}
+		accepted = append(accepted, canID(meta, 7))
+		meta.Port = (port + 1000) & SUBJECT_ID_MAX
+		rejected = append(rejected, canID(meta, 7))
+	}
+	for _, port := range services {
+		meta := Metadata{TxKind: TxKindRequest, Port: port, Remote: local, Priority: PriorityFast}
+		accepted = append(accepted, canID(meta, 7))
+		meta.Remote = local + 1
+		rejected = append(rejected, canID(meta, 7))
+	}
+
+	all, err := ins.Filters(len(subjects) + len(services))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != len(subjects)+len(services) {
+		t.Fatal("expected one filter per subscription, got", len(all))
+	}
+	match := func(filters []Filter, id uint32) bool {
+		for _, f := range filters {
+			if f.Match(id) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, id := range accepted {
+		if !match(all, id) {
+			t.Errorf("CAN ID %#x not accepted", id)
+		}
+	}
+	for _, id := range rejected {
+		if match(all, id) {
+			t.Errorf("CAN ID %#x accepted", id)
+		}
+	}
+
+	for n := 1; n < len(all); n++ {
+		filters, err := ins.Filters(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(filters) != n {
+			t.Fatalf("expected %d filters, got %d", n, len(filters))
+		}
+		for _, id := range accepted {
+			if !match(filters, id) {
+				t.Errorf("%d filters: CAN ID %#x not accepted", n, id)
+			}
+		}
+	}
+	// Subjects 10 and 11 differ in a single bit so are consolidated first.
+	filters, _ := ins.Filters(len(all) - 1)
+	merged := ConsolidateFilters(FilterForSubject(10), FilterForSubject(11))
+	if merged.accepted() != 2*FilterForSubject(10).accepted() {
+		t.Error("expected consolidated filter to accept twice the CAN IDs")
+	}
+	found := false
+	for _, f := range filters {
+		found = found || f == merged
+	}
+	if !found {
+		t.Errorf("expected subjects 10 and 11 consolidated, got %+v", filters)
+	}
+}
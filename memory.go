@@ -0,0 +1,130 @@
+package canard
+
+import "unsafe"
+
+// MemoryResource allocates the memory used for received transfer payloads
+// and queued frame data. Implementations need not be safe for concurrent use.
+// Bookkeeping structures such as RX sessions and TX queue items are not allocated
+// from it; see TxQueue.Reserve to preallocate the latter.
+type MemoryResource interface {
+	// Allocate returns a buffer of length size. If the memory is exhausted
+	// Allocate must return ErrOutOfMemory.
+	Allocate(size int) ([]byte, error)
+	// Free hands back a buffer returned by Allocate.
+	Free(buf []byte)
+}
+
+// heapMemory is the default MemoryResource. It allocates from
+// the Go heap and keeps freed buffers for reuse.
+type heapMemory struct {
+	free [][]byte
+}
+
+func (h *heapMemory) Allocate(size int) ([]byte, error) {
+	for i := len(h.free) - 1; i >= 0; i-- {
+		buf := h.free[i]
+		if cap(buf) >= size {
+			h.free[i] = h.free[len(h.free)-1]
+			h.free[len(h.free)-1] = nil
+			h.free = h.free[:len(h.free)-1]
+			return buf[:size], nil
+		}
+	}
+	return make([]byte, size), nil
+}
+
+func (h *heapMemory) Free(buf []byte) {
+	if cap(buf) > 0 {
+		h.free = append(h.free, buf[:cap(buf)])
+	}
+}
+
+// Pool is a MemoryResource which allocates fixed size blocks from a caller
+// provided arena in constant time. It does not allocate on the Go heap after creation.
+type Pool struct {
+	arena     []byte
+	blockSize int
+	// Index of first free block. Free blocks store the index of the next free block.
+	head  int32
+	inUse int
+	peak  int
+}
+
+// Index of no block.
+const poolNil = -1
+
+// NewPool creates a Pool that divides arena into blocks of blockSize bytes.
+// Allocations larger than blockSize fail. blockSize must be at least 4.
+func NewPool(arena []byte, blockSize int) (*Pool, error) {
+	if blockSize < 4 || len(arena) < blockSize || len(arena)/blockSize > 1<<31-1 {
+		return nil, ErrInvalidArgument
+	}
+	p := &Pool{
+		arena:     arena[: len(arena)/blockSize*blockSize : len(arena)/blockSize*blockSize],
+		blockSize: blockSize,
+	}
+	numBlocks := len(p.arena) / blockSize
+	for i := 0; i < numBlocks-1; i++ {
+		p.setNext(int32(i), int32(i+1))
+	}
+	p.setNext(int32(numBlocks-1), poolNil)
+	return p, nil
+}
+
+// Allocate returns a block of the pool sliced to length size.
+func (p *Pool) Allocate(size int) ([]byte, error) {
+	if size > p.blockSize || size < 0 {
+		return nil, ErrInvalidArgument
+	}
+	if p.head == poolNil {
+		return nil, ErrOutOfMemory
+	}
+	block := p.head
+	p.head = p.next(block)
+	p.inUse += p.blockSize
+	if p.inUse > p.peak {
+		p.peak = p.inUse
+	}
+	start := int(block) * p.blockSize
+	return p.arena[start : start+size : start+p.blockSize], nil
+}
+
+// Free hands back a block obtained from Allocate. It panics if buf does not belong to the pool.
+// Freeing a block twice is not detected and corrupts the pool, which may then hand out
+// the same block to several allocations.
+func (p *Pool) Free(buf []byte) {
+	if cap(buf) == 0 {
+		return
+	}
+	base := uintptr(unsafe.Pointer(&p.arena[0]))
+	ptr := uintptr(unsafe.Pointer(&buf[:cap(buf)][0]))
+	if ptr < base || ptr >= base+uintptr(len(p.arena)) {
+		panic("pool: buffer not allocated by pool")
+	}
+	block := int32((ptr - base) / uintptr(p.blockSize))
+	p.setNext(block, p.head)
+	p.head = block
+	p.inUse -= p.blockSize
+}
+
+// InUse returns the number of bytes of the arena currently allocated.
+func (p *Pool) InUse() int { return p.inUse }
+
+// Peak returns the maximum number of bytes of the arena that were allocated at once.
+func (p *Pool) Peak() int { return p.peak }
+
+// BlockSize returns the size of the pool's blocks, which is the largest allocation possible.
+func (p *Pool) BlockSize() int { return p.blockSize }
+
+func (p *Pool) next(block int32) int32 {
+	b := p.arena[int(block)*p.blockSize:]
+	return int32(uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24)
+}
+
+func (p *Pool) setNext(block, next int32) {
+	b := p.arena[int(block)*p.blockSize:]
+	b[0] = byte(next)
+	b[1] = byte(next >> 8)
+	b[2] = byte(next >> 16)
+	b[3] = byte(next >> 24)
+}
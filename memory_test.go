@@ -0,0 +1,225 @@
+package canard
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPool(t *testing.T) {
+	const blockSize, numBlocks = 16, 4
+	_, err := NewPool(make([]byte, 8), blockSize)
+	if !errors.Is(err, ErrInvalidArgument) {
+		t.Error("expected error for arena smaller than block")
+	}
+	pool, err := NewPool(make([]byte, blockSize*numBlocks+3), blockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bufs [][]byte
+	for i := 0; i < numBlocks; i++ {
+		buf, err := pool.Allocate(i + 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(buf) != i+1 {
+			t.Error("bad buffer length", len(buf))
+		}
+		for j := range buf {
+			buf[j] = byte(i)
+		}
+		bufs = append(bufs, buf)
+	}
+	if pool.InUse() != blockSize*numBlocks || pool.Peak() != blockSize*numBlocks {
+		t.Error("bad accounting", pool.InUse(), pool.Peak())
+	}
+	_, err = pool.Allocate(1)
+	if !errors.Is(err, ErrOutOfMemory) {
+		t.Error("expected ErrOutOfMemory, got", err)
+	}
+	_, err = pool.Allocate(blockSize + 1)
+	if !errors.Is(err, ErrInvalidArgument) {
+		t.Error("expected ErrInvalidArgument for oversized allocation, got", err)
+	}
+	for i, buf := range bufs {
+		for _, b := range buf {
+			if b != byte(i) {
+				t.Fatal("blocks overlap")
+			}
+		}
+	}
+	pool.Free(bufs[2])
+	pool.Free(bufs[0][:0])
+	if pool.InUse() != blockSize*(numBlocks-2) || pool.Peak() != blockSize*numBlocks {
+		t.Error("bad accounting after free", pool.InUse(), pool.Peak())
+	}
+	a, _ := pool.Allocate(blockSize)
+	b, _ := pool.Allocate(blockSize)
+	if &a[0] != &bufs[0][:1][0] || &b[0] != &bufs[2][0] {
+		t.Error("expected freed blocks to be reused")
+	}
+}
+
+func TestTxQueueMemory(t *testing.T) {
+	const numBlocks = 6
+	pool, err := NewPool(make([]byte, _MTU_CAN_CLASSIC*numBlocks), _MTU_CAN_CLASSIC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	que := TxQueue{Cap: 100, MTU: _MTU_CAN_CLASSIC, Memory: pool}
+	meta := Metadata{
+		Priority: PriorityNominal,
+		TxKind:   TxKindMessage,
+		Port:     321,
+		Remote:   0xff,
+	}
+	payload := make([]byte, 30) // 5 frames.
+	err = que.Push(42, 0, &meta, len(payload), payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pool.InUse() != 5*_MTU_CAN_CLASSIC {
+		t.Error("expected 5 blocks in use, got", pool.InUse())
+	}
+	err = que.Push(42, 0, &meta, len(payload), payload)
+	if !errors.Is(err, ErrOutOfMemory) {
+		t.Fatal("expected ErrOutOfMemory, got", err)
+	}
+	if que.size != 5 || pool.InUse() != 5*_MTU_CAN_CLASSIC {
+		t.Error("failed push modified queue or leaked memory", que.size, pool.InUse())
+	}
+	for que.Peek() != nil {
+		que.Free(que.Pop(nil))
+	}
+	if pool.InUse() != 0 {
+		t.Error("expected all memory freed, got", pool.InUse())
+	}
+	err = que.Push(42, 0, &meta, len(payload), payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames, _ := que.Purge(1)
+	if frames != 5 || pool.InUse() != 0 {
+		t.Error("expected purge to free frames", frames, pool.InUse())
+	}
+}
+
+func TestTxQueueReserve(t *testing.T) {
+	pool, err := NewPool(make([]byte, 20*_MTU_CAN_CLASSIC), _MTU_CAN_CLASSIC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	que := TxQueue{Cap: 100, MTU: _MTU_CAN_CLASSIC, Memory: pool}
+	que.Reserve(10)
+	meta := Metadata{Priority: PriorityNominal, TxKind: TxKindMessage, Port: 321, Remote: 0xff}
+	payload := make([]byte, 30) // 5 frames.
+	for i := 0; i < 2; i++ {
+		err = que.Push(42, 0, &meta, len(payload), payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = que.Push(42, 0, &meta, len(payload), payload)
+	if !errors.Is(err, ErrOutOfMemory) {
+		t.Fatal("expected ErrOutOfMemory with reserved items exhausted, got", err)
+	}
+	if que.size != 10 || pool.InUse() != 10*_MTU_CAN_CLASSIC {
+		t.Error("failed push modified queue or leaked memory", que.size, pool.InUse())
+	}
+	allocs := testing.AllocsPerRun(10, func() {
+		que.Free(que.Pop(nil))
+		err = que.Push(42, 0, &meta, 4, payload)
+	})
+	if err != nil || allocs != 0 {
+		t.Error("expected push of reserved item not to allocate, got", allocs, err)
+	}
+}
+
+func TestTxQueueReusePadding(t *testing.T) {
+	pool, err := NewPool(make([]byte, 2*_MTU_CAN_FD), _MTU_CAN_FD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mem := range []MemoryResource{nil, pool} {
+		que := TxQueue{Cap: 10, MTU: _MTU_CAN_FD, Memory: mem}
+		meta := Metadata{Priority: PriorityNominal, TxKind: TxKindMessage, Port: 321, Remote: 0xff}
+		stale := make([]byte, 63)
+		for i := range stale {
+			stale[i] = 0xaa
+		}
+		err = que.Push(42, 0, &meta, len(stale), stale)
+		if err != nil {
+			t.Fatal(err)
+		}
+		que.Free(que.Pop(nil))
+		meta.TID++
+		payload := make([]byte, 9) // Padded to 12 bytes.
+		err = que.Push(42, 0, &meta, len(payload), payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := que.Peek().Frame().Data()
+		if len(data) != 12 {
+			t.Fatalf("got frame length %d, want 12", len(data))
+		}
+		for i, b := range data[:len(data)-1] {
+			if b != 0 {
+				t.Fatalf("byte %d of reused frame is %#x, want 0: % x", i, b, data)
+			}
+		}
+		que.Free(que.Pop(nil))
+	}
+}
+
+func TestInstanceMemory(t *testing.T) {
+	const port, extent = 0xccc, 32
+	pool, err := NewPool(make([]byte, 2*extent), extent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ins, transfer, sub, accept := newInstanceHelper()
+	ins.Memory = pool
+	err = ins.Subscribe(TxKindMessage, port, extent, 1e6, sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := Metadata{
+		Priority: PriorityNominal,
+		TxKind:   TxKindMessage,
+		Port:     port,
+		Remote:   0xff,
+	}
+	payload := []byte("pooled transfer payload")
+	var transfers []Transfer
+	for i := 0; i < 3; i++ {
+		frames := txFrames(t, _MTU_CAN_CLASSIC, 42, meta, payload)
+		meta.TID++
+		if i == 2 {
+			// Pool exhausted, payload is allocated on first frame.
+			err = accept(0, Microsecond(i), frames[0].extendedCANID, frames[0].Data())
+			if !errors.Is(err, ErrOutOfMemory) {
+				t.Fatal("expected ErrOutOfMemory with pool exhausted, got", err)
+			}
+			break
+		}
+		for _, frame := range frames {
+			err = accept(0, Microsecond(i), frame.extendedCANID, frame.Data())
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		transfers = append(transfers, *transfer)
+	}
+	if pool.InUse() != pool.Peak() || pool.Peak() != 2*extent {
+		t.Error("bad pool accounting", pool.InUse(), pool.Peak())
+	}
+	ins.Release(&transfers[0])
+	for _, frame := range txFrames(t, _MTU_CAN_CLASSIC, 42, meta, payload) {
+		err = accept(0, 10, frame.extendedCANID, frame.Data())
+	}
+	if err != nil {
+		t.Fatal("expected transfer received after release, got", err)
+	}
+	if string(transfer.Payload()) != string(payload) {
+		t.Errorf("bad payload %q", transfer.Payload())
+	}
+}
@@ -0,0 +1,108 @@
+package canard
+
+// Monitor reassembles every transfer on the bus regardless of subscriptions and
+// destination node, as is needed by bus analyzers. It uses the same session logic
+// as Instance.Accept with sessions keyed by transfer kind, port, source and destination.
+// Memory is bounded by the maximum number of sessions, each of which holds at most
+// extent bytes of payload.
+type Monitor struct {
+	extent      int
+	tidTimeout  Microsecond
+	maxSessions int
+	sessions    map[monitorKey]*internalRxSession
+	// Holds memory resource used by session logic.
+	ins Instance
+}
+
+type monitorKey struct {
+	kind TxKind
+	port PortID
+	src  NodeID
+	dst  NodeID
+}
+
+// NewMonitor returns a Monitor which stores up to extent bytes of each transfer's payload
+// and tracks at most maxSessions sessions. When a new session would exceed maxSessions
+// the least recently active session is evicted. If mem is nil the Go heap is used.
+func NewMonitor(mem MemoryResource, extent int, tidTimeout Microsecond, maxSessions int) (*Monitor, error) {
+	if extent < 0 || maxSessions <= 0 {
+		return nil, ErrInvalidArgument
+	}
+	return &Monitor{
+		extent:      extent,
+		tidTimeout:  tidTimeout,
+		maxSessions: maxSessions,
+		sessions:    make(map[monitorKey]*internalRxSession, maxSessions),
+		ins:         Instance{Memory: mem},
+	}, nil
+}
+
+// Accept processes a frame received at timestamp over the redundant interface rti.
+// It returns the same errors as Instance.Accept except ErrNoMatchingSub and ErrBadDstAddr,
+// which are never returned since all transfers are accepted. The received transfer's
+// payload should be handed back with Release once it is no longer needed.
+func (m *Monitor) Accept(timestamp Microsecond, frame *Frame, rti uint8, outTx *Transfer) error {
+	switch {
+	case m == nil || outTx == nil || frame == nil:
+		return ErrInvalidArgument
+	case len(frame.payload) == 0:
+		return errEmptyPayload
+	}
+	model := FrameModel{}
+	err := rxTryParseFrame(timestamp, frame, &model)
+	if err != nil {
+		return err
+	}
+	if model.srcNode.IsUnset() {
+		return rxAcceptAnonymous(&m.ins, &model, m.extent, outTx)
+	}
+	key := monitorKey{kind: model.txKind, port: model.port, src: model.srcNode, dst: model.dstNode}
+	rxs := m.sessions[key]
+	if rxs == nil {
+		if !model.txStart {
+			return ErrMissedStart
+		}
+		if len(m.sessions) >= m.maxSessions {
+			m.evict(timestamp)
+		}
+		rxs = newRxSession(&model, rti)
+		m.sessions[key] = rxs
+	}
+	rxs.lastFrame = timestamp
+	return rxSessionUpdate(&m.ins, rxs, &model, rti, m.tidTimeout, m.extent, outTx)
+}
+
+// Release hands the payload buffer of a transfer received by Accept back to the
+// monitor's memory resource. The transfer's payload must not be used after calling Release.
+func (m *Monitor) Release(tx *Transfer) {
+	m.ins.Release(tx)
+}
+
+// Sessions returns the number of sessions currently tracked.
+func (m *Monitor) Sessions() int { return len(m.sessions) }
+
+// evict frees all sessions which have timed out at now. If none have timed out
+// the least recently active session is freed.
+func (m *Monitor) evict(now Microsecond) {
+	var oldest monitorKey
+	var oldestSession *internalRxSession
+	evicted := false
+	for key, rxs := range m.sessions {
+		if now > rxs.lastFrame && now-rxs.lastFrame > m.tidTimeout {
+			m.free(key)
+			evicted = true
+			continue
+		}
+		if oldestSession == nil || rxs.lastFrame < oldestSession.lastFrame {
+			oldest, oldestSession = key, rxs
+		}
+	}
+	if !evicted && oldestSession != nil {
+		m.free(oldest)
+	}
+}
+
+func (m *Monitor) free(key monitorKey) {
+	m.ins.memory().Free(m.sessions[key].payload)
+	delete(m.sessions, key)
+}
@@ -0,0 +1,90 @@
+package canard
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestMonitorInterleaved(t *testing.T) {
+	const src = 42
+	payload := []byte("monitor reassembles all")
+	metas := []Metadata{
+		{Priority: PriorityNominal, TxKind: TxKindMessage, Port: 1234, Remote: 0xff, TID: 1},
+		{Priority: PriorityNominal, TxKind: TxKindRequest, Port: 100, Remote: 10, TID: 2},
+		{Priority: PriorityNominal, TxKind: TxKindRequest, Port: 100, Remote: 11, TID: 3},
+	}
+	var chains [][]Frame
+	for _, meta := range metas {
+		chains = append(chains, txFrames(t, _MTU_CAN_CLASSIC, src, meta, payload))
+	}
+	mon, err := NewMonitor(nil, 64, 1e6, len(metas))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []Transfer
+	// Interleave frames of all transfers.
+	for i := 0; i < len(chains[0]); i++ {
+		for j := range chains {
+			var tx Transfer
+			err := mon.Accept(Microsecond(i), &chains[j][i], 0, &tx)
+			if errors.Is(err, ErrTransferPending) {
+				continue
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, tx)
+		}
+	}
+	if len(got) != len(metas) {
+		t.Fatalf("got %d transfers, want %d", len(got), len(metas))
+	}
+	if mon.Sessions() != len(metas) {
+		t.Errorf("got %d sessions, want %d", mon.Sessions(), len(metas))
+	}
+	for i, tx := range got {
+		meta := tx.Metadata()
+		if meta.TxKind != metas[i].TxKind || meta.Port != metas[i].Port || meta.Remote != src || meta.TID != metas[i].TID {
+			t.Errorf("transfer %d: bad metadata %+v", i, meta)
+		}
+		if !bytes.Equal(tx.Payload(), payload) {
+			t.Errorf("transfer %d: bad payload %q", i, tx.Payload())
+		}
+		if metas[i].TxKind == TxKindMessage && !tx.Destination().IsUnset() {
+			t.Errorf("transfer %d: message with destination %d", i, tx.Destination())
+		} else if metas[i].TxKind != TxKindMessage && tx.Destination() != metas[i].Remote {
+			t.Errorf("transfer %d: got destination %d, want %d", i, tx.Destination(), metas[i].Remote)
+		}
+		mon.Release(&tx)
+	}
+}
+
+func TestMonitorEviction(t *testing.T) {
+	payload := []byte("evicted before completion")
+	metaA := Metadata{Priority: PriorityNominal, TxKind: TxKindMessage, Port: 1, Remote: 0xff}
+	metaB := Metadata{Priority: PriorityNominal, TxKind: TxKindMessage, Port: 2, Remote: 0xff}
+	chainA := txFrames(t, _MTU_CAN_CLASSIC, 1, metaA, payload)
+	chainB := txFrames(t, _MTU_CAN_CLASSIC, 1, metaB, payload)
+	mon, err := NewMonitor(nil, 64, 1e6, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tx Transfer
+	err = mon.Accept(0, &chainA[0], 0, &tx)
+	if !errors.Is(err, ErrTransferPending) {
+		t.Fatal("expected pending transfer, got", err)
+	}
+	// Session of transfer B evicts session of transfer A.
+	err = mon.Accept(1, &chainB[0], 0, &tx)
+	if !errors.Is(err, ErrTransferPending) {
+		t.Fatal("expected pending transfer, got", err)
+	}
+	if mon.Sessions() != 1 {
+		t.Fatal("expected bounded sessions, got", mon.Sessions())
+	}
+	err = mon.Accept(2, &chainA[1], 0, &tx)
+	if !errors.Is(err, ErrMissedStart) {
+		t.Error("expected missed start on evicted session, got", err)
+	}
+}
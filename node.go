@@ -0,0 +1,255 @@
+package canard
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Node owns an Instance and TxQueue and makes them safe for concurrent use.
+// Run receives frames from a Driver and transmits queued frames to it while
+// the application subscribes through channels and pushes transfers with Do.
+type Node struct {
+	// PollInterval is how long the receive and transmit loops wait before retrying
+	// a driver which has no frames available or is busy. Defaults to a millisecond.
+	PollInterval time.Duration
+	// Clock returns the current time used for transmission deadlines. It must be
+	// monotonic. Defaults to the microseconds elapsed since the node was created,
+	// as measured by the monotonic clock.
+	Clock func() Microsecond
+
+	start   time.Time
+	d       Driver
+	mu      sync.Mutex
+	ins     Instance
+	q       TxQueue
+	subs    map[nodeSubKey]*nodeSub
+	dropped int
+	running bool
+	closed  bool
+	// Wakes the transmit loop when frames are queued.
+	txReady chan struct{}
+}
+
+type nodeSubKey struct {
+	kind TxKind
+	port PortID
+}
+
+type nodeSub struct {
+	sub Sub
+	ch  chan Transfer
+}
+
+// NewNode creates a Node with node ID id which transmits and receives over d.
+// The node's transmit queue holds up to queueCap frames of up to mtu bytes.
+func NewNode(id NodeID, d Driver, mtu, queueCap int) *Node {
+	return &Node{
+		start:   time.Now(),
+		d:       d,
+		ins:     Instance{NodeID: id},
+		q:       TxQueue{Cap: queueCap, MTU: mtu},
+		subs:    make(map[nodeSubKey]*nodeSub),
+		txReady: make(chan struct{}, 1),
+	}
+}
+
+// Run receives and transmits frames until ctx is done or the driver returns an error
+// other than ErrNoFrame or ErrDriverBusy. The driver's Send and Receive methods are
+// called from different goroutines. When Run returns all subscription channels are
+// closed and the node may no longer be used.
+func (n *Node) Run(ctx context.Context) error {
+	n.mu.Lock()
+	if n.running || n.closed {
+		n.mu.Unlock()
+		return ErrNodeClosed
+	}
+	n.running = true
+	n.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errc := make(chan error, 2)
+	go func() { errc <- n.rxLoop(ctx) }()
+	go func() { errc <- n.txLoop(ctx) }()
+	err := <-errc
+	cancel()
+	<-errc
+	n.close()
+	return err
+}
+
+// Subscribe subscribes to transfers of kind on port and returns a channel on which
+// received transfers are delivered. The channel buffers up to bufSize transfers;
+// transfers received while it is full are dropped. Transfers delivered own their payload.
+// An existing subscription on the same port is replaced and its channel closed.
+// Transfers received on the channel may be handled by calling any method of the node,
+// unlike handlers of subscriptions made with Do.
+func (n *Node) Subscribe(kind TxKind, port PortID, extent int, tidTimeout Microsecond, bufSize int) (<-chan Transfer, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return nil, ErrNodeClosed
+	}
+	err := n.unsubscribe(kind, port)
+	if err != nil {
+		return nil, err
+	}
+	s := &nodeSub{ch: make(chan Transfer, bufSize)}
+	err = n.ins.Subscribe(kind, port, extent, tidTimeout, &s.sub)
+	if err != nil {
+		return nil, err
+	}
+	s.sub.SetHandler(func(_ *Sub, tx *Transfer) {
+		cp := *tx
+		cp.payload = append([]byte(nil), tx.Payload()...)
+		select {
+		case s.ch <- cp:
+		default:
+			n.dropped++
+		}
+	})
+	n.subs[nodeSubKey{kind: kind, port: port}] = s
+	return s.ch, nil
+}
+
+// Unsubscribe removes a subscription made with Subscribe and closes its channel.
+func (n *Node) Unsubscribe(kind TxKind, port PortID) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return ErrNodeClosed
+	}
+	return n.unsubscribe(kind, port)
+}
+
+// Do calls f with exclusive access to the node's Instance and TxQueue, e.g. to push
+// transfers or create publishers, clients and servers. Frames queued by f are
+// transmitted by Run. f must not retain ins or q after returning, except in handlers
+// of subscriptions made within f, such as those of servers and clients.
+//
+// Such handlers are called by Run while it holds the node's lock, so they may use
+// ins and q to push responses but must not call methods of the node, which deadlocks.
+func (n *Node) Do(f func(ins *Instance, q *TxQueue) error) error {
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		return ErrNodeClosed
+	}
+	err := f(&n.ins, &n.q)
+	n.mu.Unlock()
+	n.wakeTx()
+	return err
+}
+
+// Now returns the current time according to the node's clock.
+func (n *Node) Now() Microsecond {
+	if n.Clock != nil {
+		return n.Clock()
+	}
+	return Microsecond(time.Since(n.start).Microseconds())
+}
+
+// Dropped returns the number of transfers dropped due to full subscription channels.
+func (n *Node) Dropped() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.dropped
+}
+
+func (n *Node) rxLoop(ctx context.Context) error {
+	var tx Transfer
+	for ctx.Err() == nil {
+		frame, ts, err := n.d.Receive()
+		if errors.Is(err, ErrNoFrame) {
+			n.wait(ctx, n.pollInterval())
+			continue
+		} else if err != nil {
+			return err
+		}
+		n.mu.Lock()
+		_, err = n.ins.Accept(ts, &frame, 0, &tx)
+		if err == nil {
+			// Handlers copy the payload if they need it.
+			n.ins.Release(&tx)
+		}
+		n.mu.Unlock()
+		if err == nil {
+			// Handlers may have queued responses.
+			n.wakeTx()
+		}
+	}
+	return ctx.Err()
+}
+
+func (n *Node) txLoop(ctx context.Context) error {
+	for ctx.Err() == nil {
+		n.mu.Lock()
+		_, _, err := n.q.Pump(n.Now(), n.d)
+		pending := n.q.size > 0
+		n.mu.Unlock()
+		if err != nil {
+			return err
+		}
+		if pending {
+			// Driver is busy, retry later.
+			n.wait(ctx, n.pollInterval())
+			continue
+		}
+		select {
+		case <-ctx.Done():
+		case <-n.txReady:
+		}
+	}
+	return ctx.Err()
+}
+
+// wait blocks for d or until ctx is done.
+func (n *Node) wait(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+func (n *Node) wakeTx() {
+	select {
+	case n.txReady <- struct{}{}:
+	default:
+	}
+}
+
+func (n *Node) pollInterval() time.Duration {
+	if n.PollInterval > 0 {
+		return n.PollInterval
+	}
+	return time.Millisecond
+}
+
+func (n *Node) unsubscribe(kind TxKind, port PortID) error {
+	key := nodeSubKey{kind: kind, port: port}
+	s, ok := n.subs[key]
+	if !ok {
+		return nil
+	}
+	err := n.ins.Unsubscribe(kind, port)
+	if err != nil {
+		return err
+	}
+	close(s.ch)
+	delete(n.subs, key)
+	return nil
+}
+
+// close removes all subscriptions and marks the node as closed.
+func (n *Node) close() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for key := range n.subs {
+		n.unsubscribe(key.kind, key.port)
+	}
+	n.closed = true
+}
@@ -0,0 +1,131 @@
+package canard
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNode(t *testing.T) {
+	const subject = 1234
+	d := &MemDriver{MailboxSize: 8}
+	node := NewNode(10, d, _MTU_CAN_CLASSIC, 16)
+	ch, err := node.Subscribe(TxKindMessage, subject, 64, 1e6, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runErr := make(chan error, 1)
+	go func() { runErr <- node.Run(ctx) }()
+
+	// Receive a multi-frame transfer.
+	payload := []byte("concurrent node reception")
+	meta := Metadata{Priority: PriorityNominal, TxKind: TxKindMessage, Port: subject, Remote: 0xff, TID: 5}
+	for i, frame := range txFrames(t, _MTU_CAN_CLASSIC, 42, meta, payload) {
+		d.Inject(Microsecond(i), frame)
+	}
+	select {
+	case tx := <-ch:
+		if !bytes.Equal(tx.Payload(), payload) || tx.Metadata().Remote != 42 || tx.Metadata().TID != 5 {
+			t.Errorf("bad transfer %+v", tx)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for transfer")
+	}
+
+	// Transmit a message.
+	err = node.Do(func(ins *Instance, q *TxQueue) error {
+		pub, err := NewPublisher(ins, q, subject, PriorityNominal, 1e6)
+		if err != nil {
+			return err
+		}
+		return pub.Publish(node.Now(), []byte{1, 2, 3})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		frame, _, ok := d.Transmit()
+		if ok {
+			if ecID(frame.ID()).Source() != 10 || !bytes.Equal(frame.Data()[:3], []byte{1, 2, 3}) {
+				t.Errorf("bad frame transmitted %#x %v", frame.ID(), frame.Data())
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for transmission")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case err := <-runErr:
+		if !errors.Is(err, context.Canceled) {
+			t.Error("expected context canceled, got", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after cancellation")
+	}
+	if _, ok := <-ch; ok {
+		t.Error("expected subscription channel to be closed")
+	}
+	if err := node.Do(func(*Instance, *TxQueue) error { return nil }); !errors.Is(err, ErrNodeClosed) {
+		t.Error("expected ErrNodeClosed, got", err)
+	}
+}
+
+func TestNodeClock(t *testing.T) {
+	node := NewNode(10, &MemDriver{}, _MTU_CAN_CLASSIC, 16)
+	t0 := node.Now()
+	time.Sleep(2 * time.Millisecond)
+	t1 := node.Now()
+	// The default clock counts from the node's creation.
+	if t0 > 1e6 || t1 < t0+2000 {
+		t.Error("bad default clock readings", t0, t1)
+	}
+}
+
+func TestNodeServer(t *testing.T) {
+	const service = 100
+	d := &MemDriver{MailboxSize: 8}
+	node := NewNode(10, d, _MTU_CAN_CLASSIC, 16)
+	err := node.Do(func(ins *Instance, q *TxQueue) error {
+		// The server's handler pushes responses to q from within Run.
+		_, err := NewServer(ins, q, service, 64, 1e6, func(req *Transfer) ([]byte, error) {
+			return append([]byte("re: "), req.Payload()...), nil
+		})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go node.Run(ctx)
+
+	meta := Metadata{Priority: PriorityNominal, TxKind: TxKindRequest, Port: service, Remote: 10, TID: 3}
+	for i, frame := range txFrames(t, _MTU_CAN_CLASSIC, 42, meta, []byte("hi")) {
+		d.Inject(Microsecond(i), frame)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		frame, _, ok := d.Transmit()
+		if ok {
+			id := ecID(frame.ID())
+			if id.IsMessage() || id.IsRequest() || id.Destination() != 42 || id.Source() != 10 ||
+				!bytes.HasPrefix(frame.Data(), []byte("re: hi")) {
+				t.Errorf("bad response %#x %q", frame.ID(), frame.Data())
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for response")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,487 @@
+// Package pcap writes and reads captures of CAN frames in the pcap and pcapng
+// file formats with the LINKTYPE_CAN_SOCKETCAN link type, which Wireshark
+// dissects as Cyphal/CAN. Tap captures the frames sent and received through a
+// canard.Driver.
+package pcap
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	canard "github.com/soypat/go-canard"
+)
+
+// Format is a capture file format.
+type Format uint8
+
+const (
+	// PCAP is the classic libpcap file format with microsecond timestamps.
+	PCAP Format = iota
+	// PCAPNG is the pcap next generation file format.
+	PCAPNG
+)
+
+var (
+	// ErrFormat is returned when reading a file which is not a pcap or pcapng capture.
+	ErrFormat = errors.New("pcap: unknown file format")
+	// ErrMalformed is returned when reading a malformed capture.
+	ErrMalformed = errors.New("pcap: malformed capture")
+)
+
+const (
+	// LinkTypeSocketCAN is LINKTYPE_CAN_SOCKETCAN.
+	LinkTypeSocketCAN = 227
+
+	pcapMagic     = 0xa1b2c3d4
+	pcapMagicNano = 0xa1b23c4d
+	ngByteOrder   = 0x1a2b3c4d
+	// pcapng block types.
+	ngSectionHeader  = 0x0a0d0d0a
+	ngInterface      = 1
+	ngSimplePacket   = 3
+	ngEnhancedPacket = 6
+	ngOptionEnd      = 0
+	ngOptionTSResol  = 9
+	snapLen          = socketCANHeader + 64
+	socketCANHeader  = 8
+	socketCANEFFFlag = 0x80000000
+	socketCANRTRFlag = 0x40000000
+	socketCANErrFlag = 0x20000000
+	socketCANFDFFlag = 0x04
+	socketCANEFFMask = 0x1fffffff
+	maxBlockLength   = 1 << 20
+)
+
+// Writer writes CAN frames to a capture file.
+type Writer struct {
+	w      io.Writer
+	format Format
+	buf    []byte
+}
+
+// NewWriter writes the header of a capture in format to w and returns a Writer of its frames.
+func NewWriter(w io.Writer, format Format) (*Writer, error) {
+	pw := &Writer{w: w, format: format}
+	var b []byte
+	le := binary.LittleEndian
+	switch format {
+	case PCAP:
+		b = make([]byte, 24)
+		le.PutUint32(b[0:], pcapMagic)
+		le.PutUint16(b[4:], 2) // Version 2.4.
+		le.PutUint16(b[6:], 4)
+		le.PutUint32(b[16:], snapLen)
+		le.PutUint32(b[20:], LinkTypeSocketCAN)
+	case PCAPNG:
+		// Section header block followed by interface description block.
+		b = make([]byte, 28+20)
+		le.PutUint32(b[0:], ngSectionHeader)
+		le.PutUint32(b[4:], 28)
+		le.PutUint32(b[8:], ngByteOrder)
+		le.PutUint16(b[12:], 1) // Version 1.0.
+		le.PutUint64(b[16:], ^uint64(0))
+		le.PutUint32(b[24:], 28)
+		idb := b[28:]
+		le.PutUint32(idb[0:], ngInterface)
+		le.PutUint32(idb[4:], 20)
+		le.PutUint16(idb[8:], LinkTypeSocketCAN)
+		le.PutUint32(idb[12:], snapLen)
+		le.PutUint32(idb[16:], 20)
+	default:
+		return nil, ErrFormat
+	}
+	_, err := w.Write(b)
+	if err != nil {
+		return nil, err
+	}
+	return pw, nil
+}
+
+// WriteFrame writes frame captured at timestamp in microseconds since the Unix epoch.
+func (w *Writer) WriteFrame(timestamp canard.Microsecond, frame canard.Frame) error {
+	data := frame.Data()
+	packetLen := socketCANHeader + len(data)
+	le := binary.LittleEndian
+	b := w.buf[:0]
+	switch w.format {
+	case PCAP:
+		b = append(b, make([]byte, 16)...)
+		le.PutUint32(b[0:], uint32(timestamp/1e6))
+		le.PutUint32(b[4:], uint32(timestamp%1e6))
+		le.PutUint32(b[8:], uint32(packetLen))
+		le.PutUint32(b[12:], uint32(packetLen))
+	case PCAPNG:
+		padded := (packetLen + 3) &^ 3
+		blockLen := 28 + padded + 4
+		b = append(b, make([]byte, 28)...)
+		le.PutUint32(b[0:], ngEnhancedPacket)
+		le.PutUint32(b[4:], uint32(blockLen))
+		le.PutUint32(b[8:], 0) // Interface ID.
+		le.PutUint32(b[12:], uint32(uint64(timestamp)>>32))
+		le.PutUint32(b[16:], uint32(timestamp))
+		le.PutUint32(b[20:], uint32(packetLen))
+		le.PutUint32(b[24:], uint32(packetLen))
+	}
+	b = appendSocketCAN(b, frame)
+	if w.format == PCAPNG {
+		// Padding and trailing block length.
+		for len(b)%4 != 0 {
+			b = append(b, 0)
+		}
+		b = append(b, b[4:8]...)
+	}
+	w.buf = b
+	_, err := w.w.Write(b)
+	return err
+}
+
+// appendSocketCAN appends frame as a struct can_frame or canfd_frame with
+// the CAN ID in network byte order, as in LINKTYPE_CAN_SOCKETCAN captures.
+func appendSocketCAN(b []byte, frame canard.Frame) []byte {
+	data := frame.Data()
+	var flags byte
+	if frame.IsFD() {
+		flags = socketCANFDFFlag
+	}
+	var hdr [socketCANHeader]byte
+	binary.BigEndian.PutUint32(hdr[:], frame.ID()|socketCANEFFFlag)
+	hdr[4] = byte(len(data))
+	hdr[5] = flags
+	b = append(b, hdr[:]...)
+	return append(b, data...)
+}
+
+// Reader reads CAN frames from a pcap or pcapng capture.
+type Reader struct {
+	r      io.Reader
+	format Format
+	order  binary.ByteOrder
+	// Timestamp units per second of pcap records.
+	pcapUnits uint64
+	// Link type and timestamp units per second of each pcapng interface.
+	ifaces []ngInterfaceDesc
+	buf    []byte
+}
+
+type ngInterfaceDesc struct {
+	linkType uint16
+	units    uint64
+}
+
+// NewReader reads the header of the capture in r and returns a Reader of its frames.
+func NewReader(r io.Reader) (*Reader, error) {
+	var magic [4]byte
+	_, err := io.ReadFull(r, magic[:])
+	if err != nil {
+		return nil, err
+	}
+	pr := &Reader{r: r}
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		switch order.Uint32(magic[:]) {
+		case pcapMagic:
+			pr.pcapUnits = 1e6
+		case pcapMagicNano:
+			pr.pcapUnits = 1e9
+		default:
+			continue
+		}
+		pr.format = PCAP
+		pr.order = order
+		var hdr [20]byte
+		_, err = io.ReadFull(r, hdr[:])
+		if err != nil {
+			return nil, err
+		}
+		if order.Uint32(hdr[16:]) != LinkTypeSocketCAN {
+			return nil, ErrFormat
+		}
+		return pr, nil
+	}
+	if binary.LittleEndian.Uint32(magic[:]) != ngSectionHeader {
+		return nil, ErrFormat
+	}
+	pr.format = PCAPNG
+	err = pr.readSectionHeader()
+	if err != nil {
+		return nil, err
+	}
+	return pr, nil
+}
+
+// Format returns the format of the capture.
+func (r *Reader) Format() Format { return r.format }
+
+// ReadFrame returns the next extended data frame in the capture and its timestamp in
+// microseconds since the Unix epoch. Packets of other link types and standard, remote
+// or error frames are skipped. The frame data is valid until the next call to ReadFrame.
+// It returns io.EOF at the end of the capture.
+func (r *Reader) ReadFrame() (canard.Frame, canard.Microsecond, error) {
+	for {
+		packet, ts, err := r.readPacket()
+		if err != nil {
+			return canard.Frame{}, 0, err
+		}
+		if packet == nil || len(packet) < socketCANHeader {
+			continue
+		}
+		id := binary.BigEndian.Uint32(packet)
+		length := int(packet[4])
+		if id&socketCANEFFFlag == 0 || id&(socketCANRTRFlag|socketCANErrFlag) != 0 || socketCANHeader+length > len(packet) {
+			continue
+		}
+		frame, err := canard.NewFrame(id&socketCANEFFMask, packet[socketCANHeader:socketCANHeader+length])
+		if err != nil {
+			continue
+		}
+		return frame, ts, nil
+	}
+}
+
+// readPacket returns the next packet. packet is nil for packets which are not SocketCAN frames.
+func (r *Reader) readPacket() (packet []byte, ts canard.Microsecond, err error) {
+	if r.format == PCAP {
+		var hdr [16]byte
+		_, err = io.ReadFull(r.r, hdr[:])
+		if err != nil {
+			return nil, 0, err
+		}
+		sec := uint64(r.order.Uint32(hdr[0:]))
+		frac := uint64(r.order.Uint32(hdr[4:]))
+		inclLen := r.order.Uint32(hdr[8:])
+		if inclLen > maxBlockLength {
+			return nil, 0, ErrMalformed
+		}
+		packet, err = r.read(int(inclLen))
+		if err != nil {
+			return nil, 0, unexpectedEOF(err)
+		}
+		return packet, canard.Microsecond(sec*1e6 + frac*1e6/r.pcapUnits), nil
+	}
+	for {
+		blockType, body, err := r.readBlock()
+		if err != nil {
+			return nil, 0, err
+		}
+		switch blockType {
+		case ngInterface:
+			err = r.parseInterface(body)
+		case ngEnhancedPacket:
+			return r.parseEnhancedPacket(body)
+		case ngSimplePacket:
+			if len(r.ifaces) == 0 || len(body) < 4 {
+				return nil, 0, ErrMalformed
+			}
+			if r.ifaces[0].linkType != LinkTypeSocketCAN {
+				return nil, 0, nil
+			}
+			capLen := r.order.Uint32(body)
+			if capLen > uint32(len(body)-4) {
+				capLen = uint32(len(body) - 4)
+			}
+			// Simple packets have no timestamp.
+			return body[4 : 4+capLen], 0, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+}
+
+func (r *Reader) parseEnhancedPacket(body []byte) ([]byte, canard.Microsecond, error) {
+	if len(body) < 20 {
+		return nil, 0, ErrMalformed
+	}
+	iface := r.order.Uint32(body[0:])
+	if iface >= uint32(len(r.ifaces)) {
+		return nil, 0, ErrMalformed
+	}
+	ts := uint64(r.order.Uint32(body[4:]))<<32 | uint64(r.order.Uint32(body[8:]))
+	capLen := r.order.Uint32(body[12:])
+	if capLen > uint32(len(body)-20) {
+		return nil, 0, ErrMalformed
+	}
+	desc := r.ifaces[iface]
+	if desc.linkType != LinkTypeSocketCAN {
+		return nil, 0, nil
+	}
+	sec, frac := ts/desc.units, ts%desc.units
+	return body[20 : 20+capLen], canard.Microsecond(sec*1e6 + frac*1e6/desc.units), nil
+}
+
+// readSectionHeader reads the section header block after its block type.
+func (r *Reader) readSectionHeader() error {
+	var hdr [8]byte
+	_, err := io.ReadFull(r.r, hdr[:])
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	switch {
+	case binary.LittleEndian.Uint32(hdr[4:]) == ngByteOrder:
+		r.order = binary.LittleEndian
+	case binary.BigEndian.Uint32(hdr[4:]) == ngByteOrder:
+		r.order = binary.BigEndian
+	default:
+		return ErrMalformed
+	}
+	blockLen := r.order.Uint32(hdr[:])
+	if blockLen < 28 || blockLen > maxBlockLength || blockLen%4 != 0 {
+		return ErrMalformed
+	}
+	// Skip rest of block.
+	_, err = r.read(int(blockLen) - 12)
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	r.ifaces = r.ifaces[:0]
+	return nil
+}
+
+// readBlock reads a pcapng block and returns its type and body.
+func (r *Reader) readBlock() (blockType uint32, body []byte, err error) {
+	var hdr [8]byte
+	_, err = io.ReadFull(r.r, hdr[:4])
+	if err != nil {
+		return 0, nil, err
+	}
+	if binary.LittleEndian.Uint32(hdr[:]) == ngSectionHeader {
+		// Section header block type is palindromic, the byte order may change.
+		return ngSectionHeader, nil, r.readSectionHeader()
+	}
+	_, err = io.ReadFull(r.r, hdr[4:])
+	if err != nil {
+		return 0, nil, unexpectedEOF(err)
+	}
+	blockType = r.order.Uint32(hdr[0:])
+	blockLen := r.order.Uint32(hdr[4:])
+	if blockLen < 12 || blockLen > maxBlockLength || blockLen%4 != 0 {
+		return 0, nil, ErrMalformed
+	}
+	body, err = r.read(int(blockLen) - 8)
+	if err != nil {
+		return 0, nil, unexpectedEOF(err)
+	}
+	// Strip trailing block length.
+	return blockType, body[:len(body)-4], nil
+}
+
+func (r *Reader) parseInterface(body []byte) error {
+	if len(body) < 8 {
+		return ErrMalformed
+	}
+	desc := ngInterfaceDesc{linkType: r.order.Uint16(body[0:]), units: 1e6}
+	opts := body[8:]
+	for len(opts) >= 4 {
+		code := r.order.Uint16(opts[0:])
+		length := int(r.order.Uint16(opts[2:]))
+		padded := (length + 3) &^ 3
+		if code == ngOptionEnd || 4+padded > len(opts) {
+			break
+		}
+		if code == ngOptionTSResol && length == 1 {
+			desc.units = tsUnits(opts[4])
+		}
+		opts = opts[4+padded:]
+	}
+	if desc.units == 0 {
+		return ErrMalformed
+	}
+	r.ifaces = append(r.ifaces, desc)
+	return nil
+}
+
+// tsUnits returns the timestamp units per second of an if_tsresol option value.
+// The most significant bit selects a power of two instead of a power of ten.
+func tsUnits(resol byte) uint64 {
+	exp := uint64(resol & 0x7f)
+	if resol&0x80 != 0 {
+		if exp > 63 {
+			return 0
+		}
+		return 1 << exp
+	}
+	if exp > 19 {
+		return 0
+	}
+	units := uint64(1)
+	for i := uint64(0); i < exp; i++ {
+		units *= 10
+	}
+	return units
+}
+
+// read reads n bytes into the reader's buffer.
+func (r *Reader) read(n int) ([]byte, error) {
+	if cap(r.buf) < n {
+		r.buf = make([]byte, n)
+	}
+	r.buf = r.buf[:n]
+	_, err := io.ReadFull(r.r, r.buf)
+	return r.buf, err
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Tap is a canard.Driver which captures all frames sent and received through
+// another driver. Frames sent are captured with the time given by Clock.
+type Tap struct {
+	// Clock returns the capture timestamp of frames sent.
+	// Defaults to the microseconds elapsed since the Unix epoch.
+	Clock func() canard.Microsecond
+	d     canard.Driver
+	mu    sync.Mutex
+	w     *Writer
+	err   error
+}
+
+// NewTap returns a Tap capturing frames through d to w.
+func NewTap(d canard.Driver, w *Writer) *Tap {
+	return &Tap{d: d, w: w}
+}
+
+// Send sends frame through the tapped driver and captures it if it was sent.
+func (t *Tap) Send(deadline canard.Microsecond, frame canard.Frame) error {
+	err := t.d.Send(deadline, frame)
+	if err == nil {
+		t.capture(t.now(), frame)
+	}
+	return err
+}
+
+// Receive receives a frame from the tapped driver and captures it.
+func (t *Tap) Receive() (canard.Frame, canard.Microsecond, error) {
+	frame, ts, err := t.d.Receive()
+	if err == nil {
+		t.capture(ts, frame)
+	}
+	return frame, ts, err
+}
+
+// Err returns the first error writing the capture. Frames are not captured after an error.
+func (t *Tap) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+func (t *Tap) capture(ts canard.Microsecond, frame canard.Frame) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err == nil {
+		t.err = t.w.WriteFrame(ts, frame)
+	}
+}
+
+func (t *Tap) now() canard.Microsecond {
+	if t.Clock != nil {
+		return t.Clock()
+	}
+	return canard.Microsecond(time.Now().UnixMicro())
+}
@@ -0,0 +1,171 @@
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	canard "github.com/soypat/go-canard"
+)
+
+func testFrames(t *testing.T) []canard.Frame {
+	t.Helper()
+	var frames []canard.Frame
+	for _, length := range []int{1, 8, 64} {
+		data := make([]byte, length)
+		for i := range data {
+			data[i] = byte(i + length)
+		}
+		frame, err := canard.NewFrame(0x107d552a+uint32(length), data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+func TestTapRoundTrip(t *testing.T) {
+	for _, format := range []Format{PCAP, PCAPNG} {
+		var buf bytes.Buffer
+		w, err := NewWriter(&buf, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := &canard.MemDriver{MailboxSize: 8}
+		tap := NewTap(d, w)
+		tap.Clock = func() canard.Microsecond { return 1700000000123456 }
+		frames := testFrames(t)
+		// Capture frames sent and received.
+		err = tap.Send(0, frames[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, frame := range frames[1:] {
+			d.Inject(canard.Microsecond(1e6+i), frame)
+			_, _, err = tap.Receive()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if tap.Err() != nil {
+			t.Fatal(tap.Err())
+		}
+		wantTS := []canard.Microsecond{1700000000123456, 1e6, 1e6 + 1}
+
+		r, err := NewReader(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Format() != format {
+			t.Errorf("got format %d, want %d", r.Format(), format)
+		}
+		for i, want := range frames {
+			got, ts, err := r.ReadFrame()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.ID() != want.ID() || got.IsFD() != want.IsFD() || !bytes.Equal(got.Data(), want.Data()) {
+				t.Errorf("format %d frame %d: got %#x %x", format, i, got.ID(), got.Data())
+			}
+			if ts != wantTS[i] {
+				t.Errorf("format %d frame %d: got timestamp %d, want %d", format, i, ts, wantTS[i])
+			}
+		}
+		_, _, err = r.ReadFrame()
+		if err != io.EOF {
+			t.Error("expected EOF, got", err)
+		}
+	}
+}
+
+// TestReadBigEndianPcapng reads a big-endian capture with nanosecond timestamps
+// and an interface of another link type, as written by other tools.
+func TestReadBigEndianPcapng(t *testing.T) {
+	be := binary.BigEndian
+	var b []byte
+	block := func(blockType uint32, body []byte) {
+		for len(body)%4 != 0 {
+			body = append(body, 0)
+		}
+		var hdr [8]byte
+		be.PutUint32(hdr[0:], blockType)
+		be.PutUint32(hdr[4:], uint32(12+len(body)))
+		b = append(b, hdr[:]...)
+		b = append(b, body...)
+		b = append(b, hdr[4:8]...)
+	}
+	shb := make([]byte, 16)
+	be.PutUint32(shb[0:], ngByteOrder)
+	be.PutUint16(shb[4:], 1)
+	be.PutUint64(shb[8:], ^uint64(0))
+	block(ngSectionHeader, shb)
+	// Ethernet interface.
+	idb := make([]byte, 8)
+	be.PutUint16(idb[0:], 1)
+	block(ngInterface, idb)
+	// SocketCAN interface with nanosecond resolution.
+	idb = make([]byte, 16)
+	be.PutUint16(idb[0:], LinkTypeSocketCAN)
+	be.PutUint16(idb[8:], ngOptionTSResol)
+	be.PutUint16(idb[10:], 1)
+	idb[12] = 9
+	block(ngInterface, idb)
+	epb := func(iface uint32, ts uint64, packet []byte) {
+		body := make([]byte, 20)
+		be.PutUint32(body[0:], iface)
+		be.PutUint32(body[4:], uint32(ts>>32))
+		be.PutUint32(body[8:], uint32(ts))
+		be.PutUint32(body[12:], uint32(len(packet)))
+		be.PutUint32(body[16:], uint32(len(packet)))
+		block(ngEnhancedPacket, append(body, packet...))
+	}
+	frames := testFrames(t)
+	epb(0, 0, []byte{0xff, 0xff})
+	// Standard frame is skipped.
+	epb(1, 5e9, []byte{0, 0, 1, 0x23, 1, 0, 0, 0, 0xe0})
+	epb(1, 1500001000, appendSocketCAN(nil, frames[1]))
+
+	r, err := NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ts, err := r.ReadFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID() != frames[1].ID() || !bytes.Equal(got.Data(), frames[1].Data()) || ts != 1500001 {
+		t.Errorf("got frame %#x %x at %d", got.ID(), got.Data(), ts)
+	}
+	_, _, err = r.ReadFrame()
+	if err != io.EOF {
+		t.Error("expected EOF, got", err)
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	_, err := NewReader(bytes.NewReader([]byte("not a capture file")))
+	if !errors.Is(err, ErrFormat) {
+		t.Error("expected ErrFormat, got", err)
+	}
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, PCAP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.WriteFrame(0, testFrames(t)[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncated := buf.Bytes()[:buf.Len()-1]
+	r, err := NewReader(bytes.NewReader(truncated))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = r.ReadFrame()
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Error("expected unexpected EOF, got", err)
+	}
+}
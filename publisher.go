@@ -0,0 +1,56 @@
+package canard
+
+// Publisher publishes messages on a subject and manages their transfer-ID.
+type Publisher struct {
+	ins      *Instance
+	q        *TxQueue
+	subject  PortID
+	priority Priority
+	timeout  Microsecond
+	tid      TID
+}
+
+// NewPublisher creates a Publisher of messages on subject which are pushed to q
+// with the given priority. The transmission deadline of a message is the time of
+// publication plus timeout. The source node is the instance's NodeID.
+func NewPublisher(ins *Instance, q *TxQueue, subject PortID, priority Priority, timeout Microsecond) (*Publisher, error) {
+	switch {
+	case ins == nil || q == nil:
+		return nil, ErrInvalidArgument
+	case subject > SUBJECT_ID_MAX || priority >= numOfPriorities:
+		return nil, ErrInvalidArgument
+	}
+	return &Publisher{
+		ins:      ins,
+		q:        q,
+		subject:  subject,
+		priority: priority,
+		timeout:  timeout,
+	}, nil
+}
+
+// Publish pushes a message to the queue to be transmitted before now plus the
+// publisher's timeout. The transfer-ID is incremented only if the push succeeds.
+// If the instance's node ID is unset the message is published anonymously,
+// which is only possible for payloads which fit in a single frame.
+func (p *Publisher) Publish(now Microsecond, payload []byte) error {
+	meta := Metadata{
+		Priority: p.priority,
+		TxKind:   TxKindMessage,
+		Port:     p.subject,
+		TID:      p.tid,
+	}
+	meta.Remote.Unset()
+	err := p.q.Push(p.ins.NodeID, now+p.timeout, &meta, len(payload), payload)
+	if err != nil {
+		return err
+	}
+	p.tid = (p.tid + 1) & TRANSFER_ID_MAX
+	return nil
+}
+
+// TID returns the transfer-ID of the next message published.
+func (p *Publisher) TID() TID { return p.tid }
+
+// Subject returns the subject-ID messages are published on.
+func (p *Publisher) Subject() PortID { return p.subject }
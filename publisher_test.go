@@ -0,0 +1,61 @@
+package canard
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPublisher(t *testing.T) {
+	const (
+		subject = 1234
+		timeout = 100
+	)
+	ins := &Instance{NodeID: 42}
+	que := &TxQueue{Cap: 64, MTU: _MTU_CAN_CLASSIC}
+	pub, err := NewPublisher(ins, que, subject, PriorityFast, timeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewPublisher(ins, que, SUBJECT_ID_MAX+1, PriorityFast, timeout)
+	if !errors.Is(err, ErrInvalidArgument) {
+		t.Error("expected invalid subject error")
+	}
+	for i := 0; i < 2*(TRANSFER_ID_MAX+1); i++ {
+		now := Microsecond(i)
+		err = pub.Publish(now, []byte{byte(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tqi := que.Pop(nil)
+		id := ecID(tqi.Frame().ID())
+		if tqi.TailByte().TransferID() != TID(i%(TRANSFER_ID_MAX+1)) {
+			t.Errorf("publication %d: bad transfer-ID %d", i, tqi.TailByte().TransferID())
+		}
+		if id.PortID() != subject || id.Source() != ins.NodeID || id.Priority() != PriorityFast || id.IsAnonymous() {
+			t.Errorf("publication %d: bad CAN ID %#x", i, id)
+		}
+		if tqi.Deadline() != now+timeout {
+			t.Errorf("publication %d: bad deadline %d", i, tqi.Deadline())
+		}
+		que.Free(tqi)
+	}
+
+	// Anonymous publishing.
+	ins.NodeID.Unset()
+	tid := pub.TID()
+	err = pub.Publish(0, make([]byte, 20))
+	if !errors.Is(err, ErrInvalidArgument) {
+		t.Error("expected multi-frame anonymous publication to fail, got", err)
+	}
+	if pub.TID() != tid {
+		t.Error("transfer-ID incremented on failed publication")
+	}
+	err = pub.Publish(0, []byte{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tqi := que.Pop(nil)
+	if !ecID(tqi.Frame().ID()).IsAnonymous() || tqi.TailByte().TransferID() != tid {
+		t.Errorf("expected anonymous frame, got CAN ID %#x", tqi.Frame().ID())
+	}
+}
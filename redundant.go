@@ -0,0 +1,32 @@
+package canard
+
+// RedundantTxQueue fans out transfers to the TxQueues of redundant CAN interfaces.
+// Each queue has its own MTU and capacity. The index of a queue in Queues is the
+// redundant transport index to pass to Instance.Accept for frames received over
+// the same interface.
+//
+// On reception, a transfer is received over the first interface its start frame
+// arrives on. Frames of the same transfer arriving over other interfaces are rejected
+// with ErrDuplicateFrame. If the interface in use goes silent for longer than the
+// subscription's transfer-ID timeout, reception switches over to another interface.
+type RedundantTxQueue struct {
+	Queues []*TxQueue
+}
+
+// Push enqueues a transfer on every interface. A failure on one interface does not
+// prevent pushing to the others. It returns the number of interfaces the transfer
+// was enqueued on and the last error encountered.
+func (r *RedundantTxQueue) Push(src NodeID, txDeadline Microsecond, metadata *Metadata, payloadSize int, payload []byte) (n int, err error) {
+	if r == nil || len(r.Queues) == 0 {
+		return 0, ErrInvalidArgument
+	}
+	for _, q := range r.Queues {
+		qerr := q.Push(src, txDeadline, metadata, payloadSize, payload)
+		if qerr != nil {
+			err = qerr
+			continue
+		}
+		n++
+	}
+	return n, err
+}
@@ -0,0 +1,93 @@
+package canard
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRedundantTransport(t *testing.T) {
+	const (
+		port    = 0xccc
+		src     = 42
+		timeout = 1000
+	)
+	rq := RedundantTxQueue{Queues: []*TxQueue{
+		{Cap: 64, MTU: _MTU_CAN_CLASSIC},
+		{Cap: 64, MTU: _MTU_CAN_FD},
+	}}
+	meta := Metadata{
+		Priority: PriorityNominal,
+		TxKind:   TxKindMessage,
+		Port:     port,
+		Remote:   0xff,
+	}
+	payload := []byte("sent over two interfaces")
+	n, err := rq.Push(src, 0, &meta, len(payload), payload)
+	if err != nil || n != 2 {
+		t.Fatal("expected push to both interfaces", n, err)
+	}
+	if rq.Queues[0].size != 4 || rq.Queues[1].size != 1 {
+		t.Fatal("expected frames according to interface MTU", rq.Queues[0].size, rq.Queues[1].size)
+	}
+	// Capacity of one interface exhausted.
+	rq.Queues[0].Cap = 4
+	meta.TID++
+	n, err = rq.Push(src, 0, &meta, len(payload), payload)
+	if !errors.Is(err, ErrTxQueueFull) || n != 1 {
+		t.Error("expected push to second interface only", n, err)
+	}
+
+	ins, transfer, sub, accept := newInstanceHelper()
+	err = ins.Subscribe(TxKindMessage, port, 64, timeout, sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pop := func(rti uint8) Frame {
+		return rq.Queues[rti].Pop(nil).Frame()
+	}
+	received := 0
+	acceptFrom := func(rti uint8, ts Microsecond, frame Frame) {
+		t.Helper()
+		err := accept(rti, ts, frame.ID(), frame.Data())
+		switch {
+		case err == nil:
+			received++
+			// Single frame transfers over CAN FD carry padding.
+			if len(transfer.Payload()) < len(payload) || string(transfer.Payload()[:len(payload)]) != string(payload) {
+				t.Errorf("bad payload %q", transfer.Payload())
+			}
+		case !errors.Is(err, ErrTransferPending) && !errors.Is(err, ErrDuplicateFrame):
+			t.Fatal(err)
+		}
+	}
+	// Interleave frames of both interfaces. Classic interface starts first.
+	acceptFrom(0, 10, pop(0))
+	acceptFrom(1, 11, pop(1))
+	for i := 0; i < 3; i++ {
+		acceptFrom(0, 12, pop(0))
+	}
+	if received != 1 {
+		t.Fatal("expected single transfer received, got", received)
+	}
+	// Second transfer arrives only on FD interface within timeout of the classic one.
+	acceptFrom(1, 20, pop(1))
+	if received != 1 {
+		t.Fatal("expected transfer over other interface to be ignored before timeout")
+	}
+
+	// Classic interface goes silent, FD interface takes over after timeout.
+	meta.TID++
+	rq.Queues[0].Cap = 64
+	_, err = rq.Push(src, 0, &meta, len(payload), payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rq.Queues[0].Purge(1) // Lost.
+	acceptFrom(1, 10+timeout+1, pop(1))
+	if received != 2 {
+		t.Fatal("expected failover to second interface")
+	}
+	if sub.sessions[src].rti != 1 {
+		t.Error("expected session to switch interface")
+	}
+}
@@ -7,21 +7,27 @@ import (
 
 // Contains OpenCyphal receive logic. Exported functions first.
 
-func (ins *Instance) Accept(timestamp microsecond, frame *Frame, rti uint8, outTx *Transfer, outSub *Sub) error {
+// Accept processes a frame received at timestamp over the redundant interface rti.
+// A nil error means a transfer was received and written to outTx. Frames that
+// were processed but did not complete a transfer return one of ErrTransferPending,
+// ErrDuplicateFrame, ErrMissedStart, ErrTIDMismatch, ErrToggleMismatch or ErrCRCMismatch.
+// The subscription matching the frame is returned if there is one. When a transfer
+// is received the subscription's handler, if set, is called before Accept returns.
+func (ins *Instance) Accept(timestamp Microsecond, frame *Frame, rti uint8, outTx *Transfer) (*Sub, error) {
 	switch {
 	case ins == nil || outTx == nil || frame == nil:
-		return ErrInvalidArgument
+		return nil, ErrInvalidArgument
 	case len(frame.payload) == 0:
-		return errEmptyPayload
+		return nil, errEmptyPayload
 	}
 
 	model := FrameModel{}
 	err := rxTryParseFrame(timestamp, frame, &model)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if !model.dstNode.IsUnset() && ins.NodeID != model.dstNode {
-		return ErrBadDstAddr
+		return nil, ErrBadDstAddr
 	}
 	// This is the reason the function has a logarithmic time complexity of the number of subscriptions.
 	// Note also that this one of the two variable-complexity operations in the RX pipeline; the other one
@@ -29,25 +35,29 @@ func (ins *Instance) Accept(timestamp microsecond, frame *Frame, rti uint8, outT
 	portCp := model.port
 	got, err := search(&ins.rxSub[model.txKind], &portCp, predicateOnPortID, nil)
 	if errors.Is(err, ErrAVLNilRoot) || errors.Is(err, ErrAVLNodeNotFound) {
-		return ErrNoMatchingSub
+		return nil, ErrNoMatchingSub
 	}
 	if err != nil {
-		return err
+		return nil, err
 	}
 	sub := (*Sub)(unsafe.Pointer(got))
-	if outSub != nil {
-		outSub = sub
-	}
 	if sub == nil {
-		return ErrNoMatchingSub
+		return nil, ErrNoMatchingSub
 	}
 	if sub.port != model.port {
-		return errors.New("TODO sub port not equal to model port")
+		panic("bad search result")
+	}
+	err = rxAcceptFrame(ins, sub, &model, rti, outTx)
+	if err != nil {
+		return sub, err
 	}
-	return rxAcceptFrame(ins.NodeID, sub, &model, rti, outTx)
+	if handler, ok := sub.userRef.(Handler); ok && handler != nil {
+		handler(sub, outTx)
+	}
+	return sub, nil
 }
 
-func (ins *Instance) Subscribe(kind TxKind, port PortID, extent int, tidTimeout microsecond, outSub *Sub) error {
+func (ins *Instance) Subscribe(kind TxKind, port PortID, extent int, tidTimeout Microsecond, outSub *Sub) error {
 	switch {
 	case outSub == nil:
 		return ErrInvalidArgument
@@ -92,13 +102,45 @@ func (ins *Instance) Unsubscribe(kind TxKind, port PortID) error {
 	if sub.port != port {
 		panic("bad search result")
 	}
+	for i := range sub.sessions {
+		ins.freeSession(sub, i)
+	}
 	return nil
 }
 
+// CleanupSessions frees the receive sessions of remote nodes which have not sent a frame
+// within their subscription's transfer-ID timeout, releasing partially received payloads.
+// It returns the number of sessions and payload bytes reclaimed.
+func (ins *Instance) CleanupSessions(now Microsecond) (sessions, bytes int) {
+	for kind := range ins.rxSub {
+		if ins.rxSub[kind] == nil {
+			continue
+		}
+		ins.rxSub[kind].traverse(0, func(n *TreeNode) {
+			sub := (*Sub)(unsafe.Pointer(n))
+			for i, rxs := range sub.sessions {
+				if rxs != nil && now > rxs.lastFrame && now-rxs.lastFrame > sub.tidTimeout {
+					sessions++
+					bytes += ins.freeSession(sub, i)
+				}
+			}
+		})
+	}
+	return sessions, bytes
+}
+
+// Reclaimed returns the total number of sessions and payload bytes reclaimed
+// by CleanupSessions and Unsubscribe.
+func (ins *Instance) Reclaimed() (sessions, bytes int) {
+	return ins.reclaimedSessions, ins.reclaimedBytes
+}
+
 func (ins *Instance) GetSubs(kind TxKind) (subs []*Sub) {
 	switch {
 	case kind >= numberOfTxKinds:
 		panic("invalid kind")
+	case ins.rxSub[kind] == nil:
+		return nil
 	}
 	ins.rxSub[kind].traverse(0, func(n *TreeNode) {
 		sub := (*Sub)(unsafe.Pointer(n))
@@ -107,10 +149,44 @@ func (ins *Instance) GetSubs(kind TxKind) (subs []*Sub) {
 	return subs
 }
 
+// Release hands the payload buffer of a transfer received by Accept back to the
+// instance's memory resource so that it may be reused for a future transfer.
+// The transfer's payload must not be used after calling Release.
+func (ins *Instance) Release(tx *Transfer) {
+	if ins == nil || tx == nil || cap(tx.payload) == 0 {
+		return
+	}
+	ins.memory().Free(tx.payload)
+	*tx = Transfer{metadata: tx.metadata, timestamp: tx.timestamp}
+}
+
 // Below is private API.
 
+// freeSession frees the session of a subscription and returns the bytes reclaimed.
+func (ins *Instance) freeSession(sub *Sub, node int) (bytes int) {
+	rxs := sub.sessions[node]
+	if rxs == nil {
+		return 0
+	}
+	bytes = cap(rxs.payload)
+	ins.memory().Free(rxs.payload)
+	sub.sessions[node] = nil
+	ins.reclaimedSessions++
+	ins.reclaimedBytes += bytes
+	return bytes
+}
+
+func (ins *Instance) memory() MemoryResource {
+	if ins.Memory != nil {
+		return ins.Memory
+	}
+	return &ins.heap
+}
+
 type internalRxSession struct {
-	txTimestamp      microsecond
+	txTimestamp Microsecond
+	// Timestamp of last frame received from the remote node.
+	lastFrame        Microsecond
 	totalPayloadSize int
 	payloadSize      int
 	payload          []byte
@@ -121,52 +197,53 @@ type internalRxSession struct {
 	toggle bool
 }
 
-func rxSessionWritePayload(rxs *internalRxSession, extent, payloadSize int, payload []byte) error {
+func rxSessionWritePayload(ins *Instance, rxs *internalRxSession, extent, payloadSize int, payload []byte) error {
 	switch {
 	case rxs == nil:
 		return ErrInvalidArgument
-	case len(payload) == 0 && payloadSize != 0:
+	case len(payload) < payloadSize:
 		return errEmptyPayload
-	case len(rxs.payload) > extent || len(rxs.payload) > rxs.totalPayloadSize:
-		//  CANARD_ASSERT((payload != NULL) || (payload_size == 0U)); unreachable in go
-		return errTODO
+	case rxs.payloadSize > extent || rxs.payloadSize > rxs.totalPayloadSize:
+		panic("rxs payload size out of bounds")
 	}
 
 	rxs.totalPayloadSize += payloadSize
-	if cap(rxs.payload) == 0 && extent > 0 {
+	if rxs.payload == nil && extent > 0 {
 		if rxs.payloadSize != 0 {
 			panic("assert rxs.payloadSize == 0")
 		}
 		// Allocate the payload lazily, as late as possible.
-		rxs.payload = make([]byte, extent)
+		buf, err := ins.memory().Allocate(extent)
+		if err != nil {
+			return err
+		}
+		rxs.payload = buf
 	}
 	bytesToCopy := payloadSize
 	if rxs.payloadSize+payloadSize > extent {
+		// Implicit truncation rule.
 		bytesToCopy = extent - rxs.payloadSize
-		if rxs.payloadSize > extent || rxs.payloadSize+bytesToCopy != extent || bytesToCopy >= payloadSize {
+		if rxs.payloadSize+bytesToCopy != extent || bytesToCopy >= payloadSize {
 			panic("assert payload bounds rxSessionWritePayload")
 		}
 	}
-	n := copy(rxs.payload[:rxs.payloadSize], payload[:bytesToCopy])
+	n := copy(rxs.payload[rxs.payloadSize:extent], payload[:bytesToCopy])
 	if n != bytesToCopy {
 		panic("insufficient rxs mem")
 	}
 	rxs.payloadSize += bytesToCopy
-	if rxs.payloadSize > extent {
-		panic("rxs payload exceed extent")
-	}
 	return nil
 }
 
-func rxAcceptFrame(dst NodeID, sub *Sub, frame *FrameModel, rti uint8, outTx *Transfer) error {
+func rxAcceptFrame(ins *Instance, sub *Sub, frame *FrameModel, rti uint8, outTx *Transfer) error {
 	switch {
-	case sub == nil || frame == nil || outTx == nil:
+	case ins == nil || sub == nil || frame == nil || outTx == nil:
 		return ErrInvalidArgument
 	case len(frame.payload) == 0:
 		return errEmptyPayload
 	case frame.tid > TRANSFER_ID_MAX:
 		return ErrBadTransferID
-	case !frame.dstNode.IsUnset() && dst != frame.dstNode:
+	case !frame.dstNode.IsUnset() && ins.NodeID != frame.dstNode:
 		return ErrBadDstAddr
 	case !frame.srcNode.IsValid():
 		return ErrInvalidNodeID
@@ -176,28 +253,44 @@ func rxAcceptFrame(dst NodeID, sub *Sub, frame *FrameModel, rti uint8, outTx *Tr
 		// If such session does not exist, create it. This only makes sense if this is the first frame of a
 		// transfer, otherwise, we won't be able to receive the transfer anyway so we don't bother.
 		if sub.sessions[frame.srcNode] == nil && frame.txStart {
-			sub.sessions[frame.srcNode] = &internalRxSession{
-				txTimestamp: frame.timestamp,
-				crc:         newCRC(),
-				tid:         frame.tid,
-				rti:         rti,
-				toggle:      true, // INITIAL_TOGGLE_STATE
-			}
+			sub.sessions[frame.srcNode] = newRxSession(frame, rti)
 		}
-		if sub.sessions[frame.srcNode] != nil {
-			return rxSessionUpdate(sub.sessions[frame.srcNode], frame,
-				rti, sub.tidTimeout, sub.extent, outTx)
+		if sub.sessions[frame.srcNode] == nil {
+			// We missed the first frame of the transfer.
+			return ErrMissedStart
 		}
-	} else {
-		// Anonymous transfer. Must allocate according to libcanard.
-		payloadSize := min(sub.extent, frame.payloadSize)
-		payload := make([]byte, payloadSize)
-		//rxInitTransferMetadataFromFrame(frame, &out_transfer->metadata);
-		outTx.timestamp = frame.timestamp
-		outTx.payloadSize = payloadSize
-		outTx.payload = payload
-		copy(payload, frame.payload[:payloadSize])
+		sub.sessions[frame.srcNode].lastFrame = frame.timestamp
+		return rxSessionUpdate(ins, sub.sessions[frame.srcNode], frame,
+			rti, sub.tidTimeout, sub.extent, outTx)
+	}
+	return rxAcceptAnonymous(ins, frame, sub.extent, outTx)
+}
+
+func newRxSession(frame *FrameModel, rti uint8) *internalRxSession {
+	return &internalRxSession{
+		txTimestamp: frame.timestamp,
+		crc:         newCRC(),
+		tid:         frame.tid,
+		rti:         rti,
+		toggle:      true, // INITIAL_TOGGLE_STATE
 	}
+}
+
+// rxAcceptAnonymous accepts an anonymous single frame transfer.
+func rxAcceptAnonymous(ins *Instance, frame *FrameModel, extent int, outTx *Transfer) error {
+	// Anonymous transfers are stateless. Must allocate according to libcanard.
+	payloadSize := min(extent, frame.payloadSize)
+	payload, err := ins.memory().Allocate(payloadSize)
+	if err != nil {
+		return err
+	}
+	outTx.metadata.fromRxFrame(frame)
+	outTx.pseudoID = frame.pseudoID
+	outTx.dst = frame.dstNode
+	outTx.timestamp = frame.timestamp
+	outTx.payloadSize = payloadSize
+	outTx.payload = payload
+	copy(payload, frame.payload[:payloadSize])
 	return nil
 }
 
@@ -208,7 +301,7 @@ func min(a, b int) int {
 	return b
 }
 
-func rxSessionUpdate(rxs *internalRxSession, frame *FrameModel, rti uint8, txIdTimeout microsecond, extent int, outTx *Transfer) error {
+func rxSessionUpdate(ins *Instance, rxs *internalRxSession, frame *FrameModel, rti uint8, txIdTimeout Microsecond, extent int, outTx *Transfer) error {
 	switch {
 	case rxs == nil || frame == nil || outTx == nil:
 		return ErrInvalidArgument
@@ -226,16 +319,23 @@ func rxSessionUpdate(rxs *internalRxSession, frame *FrameModel, rti uint8, txIdT
 	if needRestart && !frame.txStart {
 		// SOT miss. Following is equivalent to rxSessionRestart in libcanard
 		rxs.reset((rxs.tid+1)&TRANSFER_ID_MAX, rxs.rti) // RTI is retained
+		ins.memory().Free(rxs.payload)
 		rxs.payload = nil
-		return errTODO // freed.
-	}
-	correctTransport := rxs.rti == rti
-	correctToggle := frame.toggle == rxs.toggle
-	correctTID := frame.tid == rxs.tid
-	if correctTransport && correctToggle && correctTID {
-		return rxSessionAcceptFrame(rxs, frame, extent, outTx)
+		return ErrMissedStart
 	}
-	return errTODO
+	switch {
+	case rxs.rti != rti:
+		// Frame belongs to a transfer being received over another redundant interface.
+		return ErrDuplicateFrame
+	case frame.tid != rxs.tid && rxComputeTransferIDDifference(rxs.tid, frame.tid) == 1:
+		// Frame belongs to the last transfer received.
+		return ErrDuplicateFrame
+	case frame.tid != rxs.tid:
+		return ErrTIDMismatch
+	case frame.toggle != rxs.toggle:
+		return ErrToggleMismatch
+	}
+	return rxSessionAcceptFrame(ins, rxs, frame, extent, outTx)
 }
 
 func rxComputeTransferIDDifference(a, b TID) uint8 {
@@ -246,7 +346,7 @@ func rxComputeTransferIDDifference(a, b TID) uint8 {
 	return uint8(diff)
 }
 
-func rxSessionAcceptFrame(rxs *internalRxSession, frame *FrameModel, extent int, outTx *Transfer) error {
+func rxSessionAcceptFrame(ins *Instance, rxs *internalRxSession, frame *FrameModel, extent int, outTx *Transfer) error {
 	switch {
 	case rxs == nil || frame == nil || outTx == nil:
 		return ErrInvalidArgument
@@ -263,20 +363,23 @@ func rxSessionAcceptFrame(rxs *internalRxSession, frame *FrameModel, extent int,
 	if !singleFrame {
 		rxs.crc = rxs.crc.Add(frame.payload[:frame.payloadSize])
 	}
-	err := rxSessionWritePayload(rxs, extent, frame.payloadSize, frame.payload)
+	err := rxSessionWritePayload(ins, rxs, extent, frame.payloadSize, frame.payload)
 	if err != nil {
-		// OOM session restart here.
+		// Out of memory, restart session.
+		rxs.reset(rxs.tid+1, rxs.rti)
 		return err
 	}
 	if !frame.txEnd {
 		rxs.toggle = !rxs.toggle
-		return errTODO // not sure if this correct
+		return ErrTransferPending
 	}
 	if !singleFrame && rxs.crc != 0 {
+		// The CRC of a valid transfer, including its trailing CRC, leaves no residue.
 		rxs.reset(rxs.tid+1, rxs.rti)
-		return nil
+		return ErrCRCMismatch
 	}
 	outTx.metadata.fromRxFrame(frame)
+	outTx.dst = frame.dstNode
 	outTx.timestamp = rxs.txTimestamp
 	outTx.payloadSize = rxs.payloadSize
 	outTx.payload = rxs.payload
@@ -297,7 +400,7 @@ func rxSessionAcceptFrame(rxs *internalRxSession, frame *FrameModel, extent int,
 	return nil
 }
 
-func rxTryParseFrame(ts microsecond, frame *Frame, out *FrameModel) error {
+func rxTryParseFrame(ts Microsecond, frame *Frame, out *FrameModel) error {
 	switch {
 	case frame == nil || out == nil:
 		return ErrInvalidArgument
@@ -314,6 +417,7 @@ func rxTryParseFrame(ts microsecond, frame *Frame, out *FrameModel) error {
 		out.txKind = TxKindMessage
 		out.port = PortID(canID>>offset_SubjectID) & SUBJECT_ID_MAX
 		if canID&FLAG_ANONYMOUS_MESSAGE != 0 {
+			out.pseudoID = out.srcNode
 			out.srcNode.Unset()
 		}
 		out.dstNode.Unset()
@@ -349,7 +453,7 @@ func rxTryParseFrame(ts microsecond, frame *Frame, out *FrameModel) error {
 	// valid = valid && ((!out->start_of_transfer) || (INITIAL_TOGGLE_STATE == out->toggle));
 	valid = valid && (!out.txStart || out.toggle) //
 	// Anonymous transfers can be only single-frame transfers.
-	valid = valid && ((out.txStart && out.txEnd) || out.srcNode.IsUnset())
+	valid = valid && ((out.txStart && out.txEnd) || !out.srcNode.IsUnset())
 	// Non-last frames of a multi-frame transfer shall utilize the MTU fully.
 	valid = valid && ((out.payloadSize >= MFT_NON_LAST_FRAME_PAYLOAD_MIN) || out.txEnd)
 	// A frame that is a part of a multi-frame transfer cannot be empty (tail byte not included).
@@ -361,8 +465,9 @@ func rxTryParseFrame(ts microsecond, frame *Frame, out *FrameModel) error {
 }
 
 func (rxs *internalRxSession) reset(txid TID, rti uint8) {
+	// Payload buffer is kept for the next transfer.
 	rxs.totalPayloadSize = 0
-	rxs.payload = rxs.payload[:0]
+	rxs.payloadSize = 0
 	rxs.crc = newCRC()
 	rxs.tid = txid & TRANSFER_ID_MAX
 	rxs.toggle = true // INITIAL TOGGLE STATE
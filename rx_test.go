@@ -131,16 +131,312 @@ func TestInstanceAccept(t *testing.T) {
 	}
 }
 
-func newInstanceHelper() (ins *Instance, t *Transfer, sub *Sub, accept func(rti uint8, timestamp microsecond, canid uint32, payload []byte) error) {
+func newInstanceHelper() (ins *Instance, t *Transfer, sub *Sub, accept func(rti uint8, timestamp Microsecond, canid uint32, payload []byte) error) {
 	ins = &Instance{}
 	t = &Transfer{}
 	sub = &Sub{}
-	accept = func(rti uint8, timestamp microsecond, canid uint32, payload []byte) error {
-		return ins.Accept(timestamp, &Frame{
+	accept = func(rti uint8, timestamp Microsecond, canid uint32, payload []byte) error {
+		_, err := ins.Accept(timestamp, &Frame{
 			extendedCANID: canid,
 			payloadSize:   len(payload),
 			payload:       payload,
-		}, rti, t, sub)
+		}, rti, t)
+		return err
 	}
 	return ins, t, sub, accept
 }
+
+func TestInstanceAcceptMultiFrame(t *testing.T) {
+	const (
+		port    = 0xccc
+		src     = 42
+		timeout = 2e6
+	)
+	payload := []byte("go-canard rocks")
+	meta := Metadata{
+		Priority: PriorityNominal,
+		TxKind:   TxKindMessage,
+		Port:     port,
+		Remote:   0xff,
+		TID:      5,
+	}
+	frames := txFrames(t, _MTU_CAN_CLASSIC, src, meta, payload)
+	if len(frames) != 3 {
+		t.Fatal("expected 3 frames, got", len(frames))
+	}
+	ins, transfer, sub, accept := newInstanceHelper()
+	err := ins.Subscribe(TxKindMessage, port, 64, timeout, sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Start of transfer missed.
+	err = accept(0, 1, frames[1].extendedCANID, frames[1].Data())
+	if !errors.Is(err, ErrMissedStart) {
+		t.Error("expected ErrMissedStart, got", err)
+	}
+	for i, frame := range frames {
+		err = accept(0, Microsecond(10+i), frame.extendedCANID, frame.Data())
+		if i < len(frames)-1 && !errors.Is(err, ErrTransferPending) {
+			t.Fatalf("frame %d: expected ErrTransferPending, got %v", i, err)
+		} else if i == len(frames)-1 && err != nil {
+			t.Fatalf("last frame: %v", err)
+		}
+	}
+	if transfer.timestamp != 10 || transfer.metadata.TID != meta.TID || transfer.metadata.Remote != src {
+		t.Errorf("bad transfer metadata %+v", transfer)
+	}
+	if string(transfer.payload[:transfer.payloadSize]) != string(payload) {
+		t.Errorf("bad payload, got %q", transfer.payload[:transfer.payloadSize])
+	}
+
+	// Same transfer received again.
+	err = accept(0, 20, frames[0].extendedCANID, frames[0].Data())
+	if !errors.Is(err, ErrDuplicateFrame) {
+		t.Error("expected ErrDuplicateFrame, got", err)
+	}
+
+	// Missing middle frame.
+	meta.TID++
+	frames = txFrames(t, _MTU_CAN_CLASSIC, src, meta, payload)
+	err = accept(0, 30, frames[0].extendedCANID, frames[0].Data())
+	if !errors.Is(err, ErrTransferPending) {
+		t.Fatal("expected ErrTransferPending, got", err)
+	}
+	err = accept(0, 31, frames[2].extendedCANID, frames[2].Data())
+	if !errors.Is(err, ErrToggleMismatch) {
+		t.Error("expected ErrToggleMismatch, got", err)
+	}
+
+	// Frame from a different transfer mid-transfer.
+	meta.TID += 2
+	other := txFrames(t, _MTU_CAN_CLASSIC, src, meta, payload)
+	err = accept(0, 32, other[1].extendedCANID, other[1].Data())
+	if !errors.Is(err, ErrTIDMismatch) {
+		t.Error("expected ErrTIDMismatch, got", err)
+	}
+
+	// Corrupted payload.
+	meta.TID++
+	frames = txFrames(t, _MTU_CAN_CLASSIC, src, meta, payload)
+	frames[1].payload[0] ^= 1
+	for i, frame := range frames {
+		err = accept(0, Microsecond(40+i), frame.extendedCANID, frame.Data())
+	}
+	if !errors.Is(err, ErrCRCMismatch) {
+		t.Error("expected ErrCRCMismatch, got", err)
+	}
+}
+
+// txFrames returns the frames of a transfer as generated by TxQueue.
+func txFrames(t *testing.T, mtu int, src NodeID, meta Metadata, payload []byte) (frames []Frame) {
+	t.Helper()
+	que := TxQueue{Cap: 64, MTU: mtu}
+	err := que.Push(src, 0, &meta, len(payload), payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for que.Peek() != nil {
+		frames = append(frames, que.Pop(nil).Frame())
+	}
+	return frames
+}
+
+func TestInstanceRelease(t *testing.T) {
+	const port = 0xccc
+	meta := Metadata{
+		Priority: PriorityNominal,
+		TxKind:   TxKindMessage,
+		Port:     port,
+		Remote:   0xff,
+	}
+	ins, transfer, sub, accept := newInstanceHelper()
+	err := ins.Subscribe(TxKindMessage, port, 64, 1e6, sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receive := func(ts Microsecond, payload []byte) {
+		t.Helper()
+		for _, frame := range txFrames(t, _MTU_CAN_CLASSIC, 42, meta, payload) {
+			err = accept(0, ts, frame.extendedCANID, frame.Data())
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		meta.TID++
+	}
+	receive(10, []byte("first transfer"))
+	if string(transfer.Payload()) != "first transfer" {
+		t.Errorf("bad payload %q", transfer.Payload())
+	}
+	if transfer.Timestamp() != 10 || transfer.Metadata().Remote != 42 || transfer.Metadata().Port != port {
+		t.Errorf("bad transfer %+v", transfer)
+	}
+	first := &transfer.Payload()[0]
+	ins.Release(transfer)
+	if len(transfer.Payload()) != 0 {
+		t.Error("expected released transfer to have no payload")
+	}
+	receive(20, []byte("second transfer"))
+	if &transfer.Payload()[0] != first {
+		t.Error("expected released buffer to be reused")
+	}
+	if string(transfer.Payload()) != "second transfer" {
+		t.Errorf("bad payload %q", transfer.Payload())
+	}
+	// Without release a new buffer is allocated.
+	second := &transfer.Payload()[0]
+	receive(30, []byte("third transfer"))
+	if &transfer.Payload()[0] == second {
+		t.Error("expected unreleased buffer to be left untouched")
+	}
+}
+
+func TestInstanceCleanupSessions(t *testing.T) {
+	const (
+		port    = 0xccc
+		extent  = 32
+		timeout = 1000
+	)
+	meta := Metadata{
+		Priority: PriorityNominal,
+		TxKind:   TxKindMessage,
+		Port:     port,
+		Remote:   0xff,
+	}
+	ins, _, sub, accept := newInstanceHelper()
+	err := ins.Subscribe(TxKindMessage, port, extent, timeout, sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := []byte("a multi-frame payload")
+	// Node 10 goes silent mid-transfer.
+	frames := txFrames(t, _MTU_CAN_CLASSIC, 10, meta, payload)
+	err = accept(0, 100, frames[0].extendedCANID, frames[0].Data())
+	if !errors.Is(err, ErrTransferPending) {
+		t.Fatal(err)
+	}
+	// Node 11 completes a transfer later on.
+	for _, frame := range txFrames(t, _MTU_CAN_CLASSIC, 11, meta, payload) {
+		err = accept(0, 500, frame.extendedCANID, frame.Data())
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions, bytes := ins.CleanupSessions(100 + timeout)
+	if sessions != 0 || bytes != 0 {
+		t.Error("expected no sessions reclaimed before timeout, got", sessions, bytes)
+	}
+	sessions, bytes = ins.CleanupSessions(100 + timeout + 1)
+	if sessions != 1 || bytes != extent {
+		t.Error("expected partial session reclaimed, got", sessions, bytes)
+	}
+	if sub.sessions[10] != nil || sub.sessions[11] == nil {
+		t.Error("wrong session reclaimed")
+	}
+	err = ins.Unsubscribe(TxKindMessage, port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.sessions[11] != nil {
+		t.Error("expected sessions released on unsubscribe")
+	}
+	sessions, bytes = ins.Reclaimed()
+	if sessions != 2 || bytes != extent {
+		t.Error("bad reclaimed totals", sessions, bytes)
+	}
+}
+
+func TestInstanceAcceptAnonymous(t *testing.T) {
+	const (
+		port   = 0xccc
+		extent = 4
+	)
+	meta := Metadata{
+		Priority: PriorityHigh,
+		TxKind:   TxKindMessage,
+		Port:     port,
+		Remote:   0xff,
+		TID:      9,
+	}
+	var anonymous NodeID
+	anonymous.Unset()
+	payload := []byte("anonymous")
+	frames := txFrames(t, _MTU_CAN_FD, anonymous, meta, payload)
+	if len(frames) != 1 || !ecID(frames[0].ID()).IsAnonymous() {
+		t.Fatal("expected single anonymous frame")
+	}
+	ins, transfer, sub, accept := newInstanceHelper()
+	err := ins.Subscribe(TxKindMessage, port, extent, 1e6, sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = accept(0, 100, frames[0].ID(), frames[0].Data())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := transfer.Metadata()
+	if got.Priority != meta.Priority || got.TxKind != meta.TxKind || got.Port != meta.Port ||
+		got.TID != meta.TID || !got.Remote.IsUnset() {
+		t.Errorf("bad anonymous metadata %+v", got)
+	}
+	pseudo, ok := transfer.PseudoNodeID()
+	if !ok || pseudo != ecID(frames[0].ID()).Source() || pseudo != newNodeID(payload) {
+		t.Error("bad pseudo node ID", pseudo, ok)
+	}
+	if string(transfer.Payload()) != string(payload[:extent]) {
+		t.Errorf("expected payload truncated to extent, got %q", transfer.Payload())
+	}
+	if transfer.Timestamp() != 100 {
+		t.Error("bad timestamp", transfer.Timestamp())
+	}
+}
+
+func TestInstanceAcceptDispatch(t *testing.T) {
+	ins := &Instance{NodeID: 10}
+	meta := Metadata{
+		Priority: PriorityNominal,
+		TxKind:   TxKindMessage,
+		Remote:   0xff,
+	}
+	var subs [3]Sub
+	var got []PortID
+	for i := range subs {
+		port := PortID(100 + i)
+		err := ins.Subscribe(TxKindMessage, port, 16, 1e6, &subs[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 2 {
+			continue // Polled subscription.
+		}
+		subs[i].SetHandler(func(sub *Sub, tx *Transfer) {
+			if sub.Port() != tx.Metadata().Port {
+				t.Error("handler called with wrong subscription")
+			}
+			got = append(got, sub.Port())
+		})
+	}
+	var transfer Transfer
+	for i := range subs {
+		meta.Port = PortID(100 + i)
+		frames := txFrames(t, _MTU_CAN_CLASSIC, 42, meta, []byte("dispatched"))
+		for j := range frames {
+			sub, err := ins.Accept(1, &frames[j], 0, &transfer)
+			if sub != &subs[i] {
+				t.Errorf("transfer %d: wrong subscription returned", i)
+			}
+			if j == len(frames)-1 && err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if len(got) != 2 || got[0] != 100 || got[1] != 101 {
+		t.Error("expected handlers of first two subscriptions called, got", got)
+	}
+	meta.Port = 200
+	frames := txFrames(t, _MTU_CAN_CLASSIC, 42, meta, []byte{1})
+	sub, err := ins.Accept(1, &frames[0], 0, &transfer)
+	if sub != nil || !errors.Is(err, ErrNoMatchingSub) {
+		t.Error("expected no subscription returned", sub, err)
+	}
+}
@@ -0,0 +1,83 @@
+package canard
+
+// ServerHandler processes a request and returns the response payload.
+// If it returns an error no response is sent.
+type ServerHandler func(req *Transfer) (resp []byte, err error)
+
+// Server responds to requests of a service using a handler.
+type Server struct {
+	// OnError, if set, is called with requests dispatched by Instance.Accept whose
+	// handling failed and the error returned by Handle, such as ErrTxQueueFull or
+	// ErrOutOfMemory when the response could not be pushed.
+	OnError func(req *Transfer, err error)
+	ins     *Instance
+	q       *TxQueue
+	service PortID
+	timeout Microsecond
+	handler ServerHandler
+	sub     Sub
+	failed  int
+}
+
+// NewServer creates a Server of service which subscribes to the service's requests on
+// ins, receiving up to extent bytes of request payload. Responses are pushed to q and
+// must be transmitted within timeout of the request's reception. The instance's
+// node ID must be set. Requests received by Instance.Accept are dispatched to Handle.
+func NewServer(ins *Instance, q *TxQueue, service PortID, extent int, timeout Microsecond, handler ServerHandler) (*Server, error) {
+	switch {
+	case ins == nil || q == nil || handler == nil:
+		return nil, ErrInvalidArgument
+	case service > SERVICE_ID_MAX:
+		return nil, ErrInvalidArgument
+	case !ins.NodeID.IsSet():
+		return nil, ErrInvalidNodeID
+	}
+	s := &Server{
+		ins:     ins,
+		q:       q,
+		service: service,
+		timeout: timeout,
+		handler: handler,
+	}
+	err := ins.Subscribe(TxKindRequest, service, extent, timeout, &s.sub)
+	if err != nil {
+		return nil, err
+	}
+	s.sub.SetHandler(func(_ *Sub, req *Transfer) {
+		err := s.Handle(req)
+		if err != nil {
+			s.failed++
+			if s.OnError != nil {
+				s.OnError(req, err)
+			}
+		}
+	})
+	return s, nil
+}
+
+// Handle calls the server's handler with a request received on the server's
+// subscription and pushes the response to the requesting node. The response
+// has the priority and transfer-ID of the request.
+func (s *Server) Handle(req *Transfer) error {
+	switch {
+	case req == nil:
+		return ErrInvalidArgument
+	case req.metadata.TxKind != TxKindRequest || req.metadata.Port != s.service:
+		return ErrInvalidArgument
+	}
+	resp, err := s.handler(req)
+	if err != nil {
+		return err
+	}
+	meta := req.metadata
+	meta.TxKind = TxKindResponse
+	return s.q.Push(s.ins.NodeID, req.timestamp+s.timeout, &meta, len(resp), resp)
+}
+
+// Failed returns the number of requests dispatched by Instance.Accept whose handling failed.
+func (s *Server) Failed() int { return s.failed }
+
+// Close unsubscribes the server from the service's requests.
+func (s *Server) Close() error {
+	return s.ins.Unsubscribe(TxKindRequest, s.service)
+}
@@ -0,0 +1,106 @@
+package canard
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestServer(t *testing.T) {
+	const (
+		service = 123
+		timeout = 1000
+	)
+	errBadRequest := errors.New("bad request")
+	serverIns := &Instance{NodeID: 10}
+	serverQue := &TxQueue{Cap: 64, MTU: _MTU_CAN_CLASSIC}
+	server, err := NewServer(serverIns, serverQue, service, 64, timeout, func(req *Transfer) ([]byte, error) {
+		if string(req.Payload()) != "ping" {
+			return nil, errBadRequest
+		}
+		return []byte("pong"), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientIns := &Instance{NodeID: 20}
+	clientQue := &TxQueue{Cap: 64, MTU: _MTU_CAN_CLASSIC}
+	client, err := NewClient(clientIns, clientQue, service, 64, PrioritySlow, timeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []byte
+	callback := func(resp *Transfer, err error) {
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		got = append([]byte(nil), resp.Payload()...)
+	}
+
+	for i := 0; i < 3; i++ {
+		got = nil
+		now := Microsecond(100 * i)
+		tid, err := client.Request(now, serverIns.NodeID, []byte("ping"), callback)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Server handles request dispatched by Accept.
+		transmit(t, clientQue, serverIns, now+1)
+		tqi := serverQue.Peek()
+		if tqi == nil {
+			t.Fatal("expected response pushed")
+		}
+		id := ecID(tqi.Frame().ID())
+		if id.IsMessage() || id.IsRequest() || id.Priority() != PrioritySlow ||
+			id.Destination() != clientIns.NodeID || id.Source() != serverIns.NodeID || id.PortID() != service {
+			t.Errorf("bad response CAN ID %#x", id)
+		}
+		if tqi.Deadline() != now+1+timeout || tqi.TailByte().TransferID() != tid {
+			t.Error("bad response deadline or transfer-ID", tqi.Deadline(), tqi.TailByte().TransferID())
+		}
+		transmit(t, serverQue, clientIns, now+2)
+		if string(got) != "pong" {
+			t.Errorf("bad response %q", got)
+		}
+	}
+
+	_, err = client.Request(1000, serverIns.NodeID, []byte("pang"), callback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reqs := transmit(t, clientQue, serverIns, 1001)
+	if serverQue.Peek() != nil {
+		t.Error("expected no response on handler error")
+	}
+	if server.Failed() != 1 {
+		t.Error("expected handler error to be counted, got", server.Failed())
+	}
+	err = server.Handle(&reqs[0])
+	if !errors.Is(err, errBadRequest) || serverQue.Peek() != nil {
+		t.Error("expected handler error", err)
+	}
+
+	// Response push fails on a full queue.
+	var failedErr error
+	var failedTID TID
+	server.OnError = func(req *Transfer, err error) {
+		failedErr = err
+		failedTID = req.Metadata().TID
+	}
+	serverQue.Cap = 0
+	tid, err := client.Request(2000, serverIns.NodeID, []byte("ping"), callback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transmit(t, clientQue, serverIns, 2001)
+	if !errors.Is(failedErr, ErrTxQueueFull) || failedTID != tid || server.Failed() != 2 {
+		t.Error("expected full queue reported", failedErr, failedTID, server.Failed())
+	}
+	err = server.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(serverIns.GetSubs(TxKindRequest)) != 0 {
+		t.Error("expected server to unsubscribe on close")
+	}
+}
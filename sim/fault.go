@@ -0,0 +1,385 @@
+package sim
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+
+	canard "github.com/soypat/go-canard"
+)
+
+// FaultKind is a kind of fault injected into frames by an Injector.
+type FaultKind uint8
+
+const (
+	// FaultDrop drops the frame.
+	FaultDrop FaultKind = iota
+	// FaultDuplicate delivers the frame twice.
+	FaultDuplicate
+	// FaultDelay holds the frame back for up to MaxDelay.
+	FaultDelay
+	// FaultReorder delivers the frame after the next frame over the next redundant interface.
+	FaultReorder
+	// FaultCorrupt flips a random bit of the frame data, tail byte included.
+	FaultCorrupt
+	// FaultTruncate shortens the frame to a random shorter valid length.
+	FaultTruncate
+)
+
+func (k FaultKind) String() string {
+	switch k {
+	case FaultDrop:
+		return "drop"
+	case FaultDuplicate:
+		return "duplicate"
+	case FaultDelay:
+		return "delay"
+	case FaultReorder:
+		return "reorder"
+	case FaultCorrupt:
+		return "corrupt"
+	case FaultTruncate:
+		return "truncate"
+	}
+	return "unknown"
+}
+
+// Outcome is the result of receiving a transfer with an injected fault, as reported to Injector.Observe.
+type Outcome uint8
+
+const (
+	// Undetected means the transfer was neither delivered nor rejected with an error, i.e. it was lost.
+	Undetected Outcome = iota
+	// DetectedCRC means the transfer was rejected with canard.ErrCRCMismatch.
+	DetectedCRC
+	// DetectedToggle means a frame of the transfer was rejected with canard.ErrToggleMismatch.
+	DetectedToggle
+	// DetectedTID means a frame of the transfer was rejected with canard.ErrTIDMismatch.
+	DetectedTID
+	// DetectedMissedStart means a frame of the transfer was rejected with canard.ErrMissedStart.
+	DetectedMissedStart
+	// DetectedDuplicate means a frame of the transfer was rejected with canard.ErrDuplicateFrame.
+	DetectedDuplicate
+	// Delivered means the transfer was received despite the fault.
+	Delivered
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case Undetected:
+		return "undetected"
+	case DetectedCRC:
+		return "crc"
+	case DetectedToggle:
+		return "toggle"
+	case DetectedTID:
+		return "tid"
+	case DetectedMissedStart:
+		return "missed start"
+	case DetectedDuplicate:
+		return "duplicate"
+	case Delivered:
+		return "delivered"
+	}
+	return "unknown"
+}
+
+// Faults sets the probability of each fault being injected into a frame.
+// Faults are rolled independently in the order of the fields.
+type Faults struct {
+	Drop      float64
+	Corrupt   float64
+	Truncate  float64
+	Delay     float64
+	Reorder   float64
+	Duplicate float64
+	// MaxDelay is the longest delay of delayed frames in microseconds.
+	MaxDelay canard.Microsecond
+	// Interfaces is the number of redundant interfaces frames are reordered across.
+	// Values below 2 reorder frames on the same interface.
+	Interfaces int
+}
+
+// Fault is a fault injected into a frame of the transfer identified by the frame's CAN ID and transfer-ID.
+type Fault struct {
+	Kind    FaultKind
+	CANID   uint32
+	TID     canard.TID
+	Outcome Outcome
+}
+
+// Delivery is a frame output by an Injector with its reception timestamp and redundant interface.
+type Delivery struct {
+	Timestamp canard.Microsecond
+	Frame     canard.Frame
+	RTI       uint8
+	// Transfer the frame belonged to before faults were injected.
+	key faultKey
+}
+
+// Start of transfer bit of the tail byte.
+const startOfTransfer = 1 << 7
+
+type faultKey struct {
+	canID uint32
+	tid   canard.TID
+}
+
+type heldFrame struct {
+	Delivery
+	due canard.Microsecond
+}
+
+// Injector injects faults into a stream of frames with seeded randomness
+// and keeps a record of the faults and their outcomes.
+type Injector struct {
+	Faults
+	rng *rand.Rand
+	// Frames held back by delay and reorder faults.
+	delayed   []heldFrame
+	reordered []Delivery
+	faults    []Fault
+	// Indices of faults with undetermined outcome by transfer.
+	pending map[faultKey][]int
+}
+
+// NewInjector returns an Injector of faults whose randomness is seeded with seed.
+func NewInjector(seed int64, faults Faults) *Injector {
+	return &Injector{
+		Faults:  faults,
+		rng:     rand.New(rand.NewSource(seed)),
+		pending: make(map[faultKey][]int),
+	}
+}
+
+// Apply passes a frame received at timestamp over redundant interface rti through the
+// injector and returns the frames to be delivered, which may include frames held back
+// by earlier calls. Delivered frames own their data.
+func (inj *Injector) Apply(timestamp canard.Microsecond, frame canard.Frame, rti uint8) []Delivery {
+	data := frame.Data()
+	if len(data) == 0 {
+		return nil
+	}
+	tail := data[len(data)-1]
+	key := faultKey{canID: frame.ID(), tid: canard.TID(tail & canard.TRANSFER_ID_MAX)}
+	if tail&startOfTransfer != 0 {
+		// A new transfer with the key of an earlier transfer. Faults of the earlier
+		// transfer whose outcome has not been observed remain undetected.
+		delete(inj.pending, key)
+	}
+	out := inj.releaseDelayed(timestamp, false)
+	d := Delivery{Timestamp: timestamp, RTI: rti, key: key}
+	data = append([]byte(nil), data...)
+	if inj.roll(inj.Drop) {
+		inj.inject(FaultDrop, key)
+		return out
+	}
+	if inj.roll(inj.Corrupt) {
+		inj.inject(FaultCorrupt, key)
+		bit := inj.rng.Intn(8 * len(data))
+		data[bit/8] ^= 1 << (bit % 8)
+	}
+	if len(data) > 1 && inj.roll(inj.Truncate) {
+		inj.inject(FaultTruncate, key)
+		data = data[:inj.shorterLength(len(data))]
+	}
+	// Data length is a valid CAN length, NewFrame cannot fail.
+	d.Frame, _ = canard.NewFrame(frame.ID(), data)
+
+	reordered := inj.reordered
+	inj.reordered = nil
+	switch {
+	case inj.roll(inj.Delay):
+		inj.inject(FaultDelay, key)
+		due := timestamp + 1
+		if inj.MaxDelay > 1 {
+			due = timestamp + 1 + canard.Microsecond(inj.rng.Int63n(int64(inj.MaxDelay)))
+		}
+		inj.delayed = append(inj.delayed, heldFrame{Delivery: d, due: due})
+		sort.SliceStable(inj.delayed, func(i, j int) bool { return inj.delayed[i].due < inj.delayed[j].due })
+	case inj.roll(inj.Reorder):
+		inj.inject(FaultReorder, key)
+		if inj.Interfaces > 1 {
+			d.RTI = uint8((int(rti) + 1) % inj.Interfaces)
+		}
+		inj.reordered = append(inj.reordered, d)
+	default:
+		out = append(out, d)
+		if inj.roll(inj.Duplicate) {
+			inj.inject(FaultDuplicate, key)
+			out = append(out, d)
+		}
+	}
+	// Frames reordered by previous calls follow the current frame.
+	for _, r := range reordered {
+		r.Timestamp = timestamp
+		out = append(out, r)
+	}
+	return out
+}
+
+// Flush returns all frames held back by delay and reorder faults.
+func (inj *Injector) Flush() []Delivery {
+	out := inj.releaseDelayed(0, true)
+	out = append(out, inj.reordered...)
+	inj.reordered = nil
+	return out
+}
+
+// Observe records the result of canard.Instance.Accept for a delivered frame,
+// determining the outcome of faults injected into the frame's transfer.
+func (inj *Injector) Observe(d Delivery, err error) {
+	var outcome Outcome
+	switch {
+	case err == nil:
+		outcome = Delivered
+	case errors.Is(err, canard.ErrCRCMismatch):
+		outcome = DetectedCRC
+	case errors.Is(err, canard.ErrToggleMismatch):
+		outcome = DetectedToggle
+	case errors.Is(err, canard.ErrTIDMismatch):
+		outcome = DetectedTID
+	case errors.Is(err, canard.ErrMissedStart):
+		outcome = DetectedMissedStart
+	case errors.Is(err, canard.ErrDuplicateFrame):
+		outcome = DetectedDuplicate
+	default:
+		return
+	}
+	for _, i := range inj.pending[d.key] {
+		inj.faults[i].Outcome = outcome
+	}
+	delete(inj.pending, d.key)
+}
+
+// Injected returns all faults injected and their outcomes.
+func (inj *Injector) Injected() []Fault { return inj.faults }
+
+// Count returns the number of faults of kind injected with outcome.
+func (inj *Injector) Count(kind FaultKind, outcome Outcome) (n int) {
+	for _, f := range inj.faults {
+		if f.Kind == kind && f.Outcome == outcome {
+			n++
+		}
+	}
+	return n
+}
+
+func (inj *Injector) inject(kind FaultKind, key faultKey) {
+	inj.pending[key] = append(inj.pending[key], len(inj.faults))
+	inj.faults = append(inj.faults, Fault{Kind: kind, CANID: key.canID, TID: key.tid})
+}
+
+// releaseDelayed returns delayed frames due at or before now, or all delayed frames if all is set.
+func (inj *Injector) releaseDelayed(now canard.Microsecond, all bool) (out []Delivery) {
+	n := 0
+	for _, h := range inj.delayed {
+		if !all && h.due > now {
+			break
+		}
+		h.Timestamp = h.due
+		out = append(out, h.Delivery)
+		n++
+	}
+	inj.delayed = inj.delayed[n:]
+	return out
+}
+
+func (inj *Injector) roll(p float64) bool {
+	return p > 0 && inj.rng.Float64() < p
+}
+
+// shorterLength returns a random valid CAN data length which is at least 1 and shorter than length.
+func (inj *Injector) shorterLength(length int) int {
+	var lengths []int
+	for _, l := range [...]int{1, 2, 3, 4, 5, 6, 7, 8, 12, 16, 20, 24, 32, 48} {
+		if l < length {
+			lengths = append(lengths, l)
+		}
+	}
+	return lengths[inj.rng.Intn(len(lengths))]
+}
+
+// Driver is a canard.Driver which injects faults into the frames received from
+// and sent to another driver. Frames sent are timestamped with Clock.
+type Driver struct {
+	// Injector of faults into received frames.
+	RX *Injector
+	// Injector of faults into sent frames. May be nil.
+	TX *Injector
+	// Clock returns the current time used as timestamp of sent frames.
+	Clock func() canard.Microsecond
+	d     canard.Driver
+	rxBuf []Delivery
+	last  Delivery
+	// Frames output by the TX injector not yet accepted by the wrapped driver.
+	txBacklog []txFrame
+}
+
+type txFrame struct {
+	deadline canard.Microsecond
+	frame    canard.Frame
+}
+
+// NewDriver returns a Driver injecting faults into frames received from d with rx.
+func NewDriver(d canard.Driver, rx *Injector) *Driver {
+	return &Driver{d: d, RX: rx}
+}
+
+// Send sends frame through the wrapped driver after applying the TX injector.
+// Frames output by the injector which the wrapped driver refuses are kept and sent
+// on later calls before frame is applied. Once frame is applied Send returns nil so
+// that it is not sent again; errors sending the kept frames are returned by the next call.
+func (fd *Driver) Send(deadline canard.Microsecond, frame canard.Frame) error {
+	if fd.TX == nil {
+		return fd.d.Send(deadline, frame)
+	}
+	err := fd.flushTX()
+	if err != nil {
+		return err
+	}
+	var now canard.Microsecond
+	if fd.Clock != nil {
+		now = fd.Clock()
+	}
+	for _, d := range fd.TX.Apply(now, frame, 0) {
+		fd.txBacklog = append(fd.txBacklog, txFrame{deadline: deadline, frame: d.Frame})
+	}
+	// Frame consumed, errors are reported by the next call.
+	fd.flushTX()
+	return nil
+}
+
+// flushTX sends the TX backlog through the wrapped driver until it is empty or the driver fails.
+func (fd *Driver) flushTX() error {
+	for len(fd.txBacklog) > 0 {
+		f := fd.txBacklog[0]
+		err := fd.d.Send(f.deadline, f.frame)
+		if err != nil {
+			return err
+		}
+		fd.txBacklog[0] = txFrame{}
+		fd.txBacklog = fd.txBacklog[1:]
+	}
+	return nil
+}
+
+// Receive returns the next frame output by the RX injector, receiving frames from the
+// wrapped driver as needed. Call Observe with the result of accepting the frame.
+func (fd *Driver) Receive() (canard.Frame, canard.Microsecond, error) {
+	for len(fd.rxBuf) == 0 {
+		frame, ts, err := fd.d.Receive()
+		if err != nil {
+			return canard.Frame{}, 0, err
+		}
+		fd.rxBuf = fd.RX.Apply(ts, frame, 0)
+	}
+	fd.last = fd.rxBuf[0]
+	fd.rxBuf = fd.rxBuf[1:]
+	return fd.last.Frame, fd.last.Timestamp, nil
+}
+
+// Observe records the result of accepting the last frame received.
+func (fd *Driver) Observe(err error) {
+	fd.RX.Observe(fd.last, err)
+}
@@ -0,0 +1,213 @@
+package sim
+
+import (
+	"bytes"
+	"testing"
+
+	canard "github.com/soypat/go-canard"
+)
+
+func testFrame(t *testing.T, id uint32, data ...byte) canard.Frame {
+	t.Helper()
+	frame, err := canard.NewFrame(id, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return frame
+}
+
+func TestInjectorFaults(t *testing.T) {
+	a := testFrame(t, 0x107d552a, 1, 2, 3, 4, 5, 6, 7, 0xe1)
+	b := testFrame(t, 0x107d552a, 8, 9, 0xe2)
+
+	inj := NewInjector(1, Faults{Drop: 1})
+	if out := inj.Apply(0, a, 0); len(out) != 0 || inj.Count(FaultDrop, Undetected) != 1 {
+		t.Errorf("expected frame dropped, got %v", out)
+	}
+
+	inj = NewInjector(1, Faults{Duplicate: 1})
+	out := inj.Apply(0, a, 0)
+	if len(out) != 2 || !bytes.Equal(out[0].Frame.Data(), a.Data()) || !bytes.Equal(out[1].Frame.Data(), a.Data()) {
+		t.Errorf("expected frame duplicated, got %v", out)
+	}
+
+	inj = NewInjector(1, Faults{Delay: 1, MaxDelay: 100})
+	out = inj.Apply(0, a, 0)
+	inj.Delay = 0
+	if len(out) != 0 {
+		t.Fatalf("expected frame delayed, got %v", out)
+	}
+	out = inj.Apply(101, b, 0)
+	if len(out) != 2 || !bytes.Equal(out[0].Frame.Data(), a.Data()) || out[0].Timestamp == 0 || out[0].Timestamp > 100 {
+		t.Errorf("expected delayed frame before next frame, got %v", out)
+	}
+
+	inj = NewInjector(1, Faults{Reorder: 1, Interfaces: 2})
+	out = inj.Apply(0, a, 0)
+	inj.Reorder = 0
+	if len(out) != 0 {
+		t.Fatalf("expected frame held for reordering, got %v", out)
+	}
+	out = inj.Apply(10, b, 0)
+	if len(out) != 2 || !bytes.Equal(out[0].Frame.Data(), b.Data()) || !bytes.Equal(out[1].Frame.Data(), a.Data()) || out[1].RTI != 1 {
+		t.Errorf("expected frame reordered after next frame on other interface, got %v", out)
+	}
+
+	inj = NewInjector(1, Faults{Corrupt: 1})
+	out = inj.Apply(0, a, 0)
+	diff := 0
+	for i, c := range out[0].Frame.Data() {
+		for x := c ^ a.Data()[i]; x != 0; x &= x - 1 {
+			diff++
+		}
+	}
+	if len(out) != 1 || diff != 1 {
+		t.Errorf("expected a single bit flipped, got %v", out)
+	}
+
+	inj = NewInjector(1, Faults{Truncate: 1})
+	out = inj.Apply(0, a, 0)
+	if len(out) != 1 || len(out[0].Frame.Data()) >= len(a.Data()) || !bytes.HasPrefix(a.Data(), out[0].Frame.Data()) {
+		t.Errorf("expected frame truncated, got %v", out)
+	}
+}
+
+func TestInjectorSeed(t *testing.T) {
+	faults := Faults{Drop: 0.2, Corrupt: 0.2, Truncate: 0.2, Delay: 0.2, Reorder: 0.2, Duplicate: 0.2, MaxDelay: 50}
+	run := func() (out []Delivery) {
+		inj := NewInjector(42, faults)
+		for i := 0; i < 100; i++ {
+			frame := testFrame(t, 0x107d552a, byte(i), 0xe0|byte(i&31))
+			out = append(out, inj.Apply(canard.Microsecond(10*i), frame, 0)...)
+		}
+		return append(out, inj.Flush()...)
+	}
+	a, b := run(), run()
+	if len(a) != len(b) {
+		t.Fatalf("runs with same seed differ in length: %d != %d", len(a), len(b))
+	}
+	for i := range a {
+		if a[i].Timestamp != b[i].Timestamp || !bytes.Equal(a[i].Frame.Data(), b[i].Frame.Data()) {
+			t.Fatalf("runs with same seed differ at frame %d", i)
+		}
+	}
+}
+
+// TestFaultRecovery subjects multi-frame transfers to faults on a simulated bus and checks
+// that silently delivered faults are reported and that reception recovers once faults stop.
+func TestFaultRecovery(t *testing.T) {
+	const subject = 1000
+	bus := NewBus(1e6, 0)
+	insA := &canard.Instance{NodeID: 1}
+	qA := &canard.TxQueue{Cap: 64, MTU: 8}
+	bus.Attach(insA, qA)
+	insB := &canard.Instance{NodeID: 2}
+	nodeB := bus.Attach(insB, &canard.TxQueue{Cap: 1, MTU: 8})
+	nodeB.Faults = NewInjector(7, Faults{Drop: 0.02, Corrupt: 0.05, Truncate: 0.02, Delay: 0.02, Reorder: 0.02, Duplicate: 0.05, MaxDelay: 500})
+	payload := []byte("fault injected multi-frame transfer")
+	var received, corrupted int
+	var sub canard.Sub
+	err := insB.Subscribe(canard.TxKindMessage, subject, 64, 2e3, &sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub.SetHandler(func(_ *canard.Sub, tx *canard.Transfer) {
+		received++
+		if !bytes.Equal(tx.Payload(), payload) {
+			corrupted++
+		}
+	})
+	pub, err := canard.NewPublisher(insA, qA, subject, canard.PriorityNominal, 1e6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publish := func(n int) {
+		for i := 0; i < n; i++ {
+			if err := pub.Publish(bus.Now(), payload); err != nil {
+				t.Fatal(err)
+			}
+			if err := bus.Run(bus.Now() + 5e3); err != nil {
+				t.Fatal(err)
+			}
+		}
+		bus.Flush()
+	}
+	publish(300)
+	for kind := FaultDrop; kind <= FaultTruncate; kind++ {
+		var counts []int
+		for outcome := Undetected; outcome <= Delivered; outcome++ {
+			counts = append(counts, nodeB.Faults.Count(kind, outcome))
+		}
+		t.Logf("%-9s undetected/crc/toggle/tid/missed/duplicate/delivered: %v", kind, counts)
+	}
+	// Single-frame transfers have no transfer CRC so frames corrupted or truncated into
+	// single-frame transfers are delivered. They must be reported as such.
+	silent := nodeB.Faults.Count(FaultCorrupt, Delivered) + nodeB.Faults.Count(FaultTruncate, Delivered)
+	if corrupted > silent {
+		t.Errorf("%d corrupted transfers delivered, %d reported", corrupted, silent)
+	}
+	if nodeB.Faults.Count(FaultCorrupt, DetectedCRC) == 0 {
+		t.Error("expected corrupted frames to be detected by CRC")
+	}
+	if n := nodeB.Faults.Count(FaultDrop, Delivered); n != 0 {
+		t.Errorf("%d transfers with dropped frames delivered", n)
+	}
+	if n := nodeB.Faults.Count(FaultDuplicate, Delivered); n == 0 {
+		t.Error("expected duplicated frames to be delivered without error")
+	}
+
+	// Reception recovers once faults stop.
+	nodeB.Faults.Faults = Faults{}
+	received = 0
+	publish(10)
+	if received != 10 {
+		t.Errorf("received %d of 10 transfers after faults stopped", received)
+	}
+}
+
+func TestDriverSendBusy(t *testing.T) {
+	a := testFrame(t, 0x107d552a, 1, 0xe1)
+	b := testFrame(t, 0x107d552a, 2, 0xe2)
+	mem := &canard.MemDriver{MailboxSize: 1}
+	fd := NewDriver(mem, NewInjector(1, Faults{}))
+	fd.TX = NewInjector(1, Faults{Duplicate: 1})
+	var got []byte
+	transmit := func() {
+		for {
+			frame, _, ok := mem.Transmit()
+			if !ok {
+				return
+			}
+			got = append(got, frame.Data()[0])
+		}
+	}
+	// The wrapped driver transmits its mailbox after refusing a frame. Refused
+	// duplicates are kept and sent first, each frame is consumed exactly once.
+	steps := []struct {
+		frame canard.Frame
+		err   error
+	}{
+		{frame: a},
+		{frame: b, err: canard.ErrDriverBusy},
+		{frame: b},
+		{frame: a, err: canard.ErrDriverBusy},
+		{frame: a, err: canard.ErrDriverBusy},
+		{frame: a},
+	}
+	for i, step := range steps {
+		err := fd.Send(0, step.frame)
+		if err != step.err {
+			t.Fatalf("step %d: got %v, want %v", i, err, step.err)
+		}
+		if err != nil {
+			transmit()
+		}
+	}
+	transmit()
+	if !bytes.Equal(got, []byte{1, 1, 2, 2}) {
+		t.Errorf("got frames % x, want 01 01 02 02", got)
+	}
+	if n := fd.TX.Count(FaultDuplicate, Undetected); n != 3 {
+		t.Errorf("got %d duplicate faults, want 3", n)
+	}
+}
@@ -0,0 +1,195 @@
+// Package sim simulates a CAN bus shared by several nodes for testing node interaction
+// without hardware. Each node is an Instance and TxQueue pair attached to the Bus.
+// The bus transmits the highest priority frame among all queues at a time, mimicking
+// bitwise arbitration, and delivers it to every other node's Instance.Accept with a
+// timestamp derived from the bitrate.
+package sim
+
+import (
+	"errors"
+
+	canard "github.com/soypat/go-canard"
+)
+
+// ErrFrameTooLong is returned by Bus.Step when a frame longer than 8 bytes is queued
+// on a classic CAN bus. The frame is dropped.
+var ErrFrameTooLong = errors.New("sim: FD frame on classic CAN bus")
+
+// Frame bit counts excluding data and bit stuffing.
+const (
+	// Extended classic frame: SOF, 29 bit ID, SRR, IDE, RTR, 2 reserved bits, DLC,
+	// 15 bit CRC and delimiter, ACK slot and delimiter, EOF and interframe space.
+	classicOverheadBits = 1 + 29 + 3 + 2 + 4 + 16 + 2 + 7 + 3
+	// Extended FD frame arbitration phase: SOF, 29 bit ID, SRR, IDE, RRS, FDF, res and BRS.
+	fdArbitrationBits = 1 + 29 + 6
+	// FD data phase: ESI, DLC and stuff count.
+	fdDataOverheadBits = 1 + 4 + 4
+	// FD frame end: CRC delimiter, ACK slot and delimiter, EOF and interframe space.
+	fdEndBits = 1 + 2 + 7 + 3
+)
+
+// Bus is a simulated CAN bus. The zero value is not usable, create buses with NewBus.
+type Bus struct {
+	// Trace, if set, is called with every frame transmitted on the bus,
+	// the node which sent it and the time its transmission completed.
+	Trace       func(ts canard.Microsecond, from *Node, frame canard.Frame)
+	bitrate     int
+	dataBitrate int
+	nodes       []*Node
+	// Simulated time in nanoseconds.
+	nanos int64
+}
+
+// Node is a node attached to a Bus.
+type Node struct {
+	Instance *canard.Instance
+	Queue    *canard.TxQueue
+	// Frames sent and received by the node and transfers received.
+	Sent, Received, Transfers int
+	// Frames dropped from the node's queue because their deadline passed.
+	Expired int
+	// Faults, if set, injects faults into the frames received by the node.
+	// The outcome of each frame accepted is reported to the injector.
+	Faults *Injector
+	rx     canard.Transfer
+}
+
+// NewBus returns a bus at bitrate in bits per second. If dataBitrate is zero the bus
+// is a classic CAN bus, otherwise it is a CAN FD bus whose frames are sent with
+// bitrate switching and data phase at dataBitrate.
+func NewBus(bitrate, dataBitrate int) *Bus {
+	if bitrate <= 0 || dataBitrate < 0 {
+		panic("sim: invalid bitrate")
+	}
+	return &Bus{bitrate: bitrate, dataBitrate: dataBitrate}
+}
+
+// Attach attaches a node to the bus. Frames pushed to q are transmitted by the bus
+// and frames transmitted by other nodes are accepted by ins. Transfers received are
+// dispatched to subscription handlers and then released.
+func (b *Bus) Attach(ins *canard.Instance, q *canard.TxQueue) *Node {
+	n := &Node{Instance: ins, Queue: q}
+	b.nodes = append(b.nodes, n)
+	return n
+}
+
+// Now returns the simulated time in microseconds.
+func (b *Bus) Now() canard.Microsecond {
+	return canard.Microsecond(b.nanos / 1e3)
+}
+
+// Advance advances the simulated time by d microseconds without transmitting frames.
+func (b *Bus) Advance(d canard.Microsecond) {
+	b.nanos += int64(d) * 1e3
+}
+
+// Step transmits the frame with the lowest CAN ID among the heads of all queues,
+// which wins arbitration, and delivers it to all other nodes. The simulated time
+// advances by the frame's transmission time. Frames whose deadline has passed are
+// purged beforehand. Step returns false if no frames are queued.
+func (b *Bus) Step() (bool, error) {
+	now := b.Now()
+	var winner *Node
+	var head *canard.TxQueueItem
+	for _, n := range b.nodes {
+		frames, _ := n.Queue.Purge(now)
+		n.Expired += frames
+		item := n.Queue.Peek()
+		if item == nil {
+			continue
+		}
+		if head == nil || item.Frame().ID() < head.Frame().ID() {
+			winner, head = n, item
+		}
+	}
+	if head == nil {
+		return false, nil
+	}
+	frame := head.Frame()
+	// Frame data is valid until the item is freed.
+	item := winner.Queue.Pop(head)
+	defer winner.Queue.Free(item)
+	if frame.IsFD() && b.dataBitrate == 0 {
+		return true, ErrFrameTooLong
+	}
+	b.nanos += b.frameNanos(len(frame.Data()))
+	now = b.Now()
+	winner.Sent++
+	if b.Trace != nil {
+		b.Trace(now, winner, frame)
+	}
+	for _, n := range b.nodes {
+		if n == winner {
+			continue
+		}
+		if n.Faults == nil {
+			n.accept(Delivery{Timestamp: now, Frame: frame})
+			continue
+		}
+		for _, d := range n.Faults.Apply(now, frame, 0) {
+			n.accept(d)
+		}
+	}
+	return true, nil
+}
+
+// Flush delivers the frames held back by the fault injectors of all nodes.
+func (b *Bus) Flush() {
+	for _, n := range b.nodes {
+		if n.Faults == nil {
+			continue
+		}
+		for _, d := range n.Faults.Flush() {
+			n.accept(d)
+		}
+	}
+}
+
+func (n *Node) accept(d Delivery) {
+	n.Received++
+	_, err := n.Instance.Accept(d.Timestamp, &d.Frame, d.RTI, &n.rx)
+	if n.Faults != nil {
+		n.Faults.Observe(d, err)
+	}
+	if err == nil {
+		n.Transfers++
+		n.Instance.Release(&n.rx)
+	}
+}
+
+// Run steps the bus until no frames are queued or the simulated time reaches until,
+// after which the time is advanced to until. Frames pushed by transfer handlers
+// during Run are also transmitted.
+func (b *Bus) Run(until canard.Microsecond) error {
+	for b.Now() < until {
+		ok, err := b.Step()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+	}
+	if b.Now() < until {
+		b.nanos = int64(until) * 1e3
+	}
+	return nil
+}
+
+// frameNanos returns the transmission time of an extended frame with length data bytes
+// in nanoseconds, without bit stuffing.
+func (b *Bus) frameNanos(length int) int64 {
+	if b.dataBitrate == 0 {
+		return bitNanos(classicOverheadBits+8*length, b.bitrate)
+	}
+	crcBits := 17
+	if length > 16 {
+		crcBits = 21
+	}
+	arbitration := bitNanos(fdArbitrationBits+fdEndBits, b.bitrate)
+	return arbitration + bitNanos(fdDataOverheadBits+8*length+crcBits, b.dataBitrate)
+}
+
+func bitNanos(bits, bitrate int) int64 {
+	return int64(bits) * 1e9 / int64(bitrate)
+}
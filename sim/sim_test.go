@@ -0,0 +1,143 @@
+package sim
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	canard "github.com/soypat/go-canard"
+)
+
+func newNode(t *testing.T, bus *Bus, id canard.NodeID, mtu int) (*canard.Instance, *canard.TxQueue) {
+	t.Helper()
+	ins := &canard.Instance{NodeID: id}
+	q := &canard.TxQueue{Cap: 64, MTU: mtu}
+	bus.Attach(ins, q)
+	return ins, q
+}
+
+func TestArbitration(t *testing.T) {
+	bus := NewBus(1e6, 0)
+	insA, qA := newNode(t, bus, 1, 8)
+	insB, qB := newNode(t, bus, 2, 8)
+	insC, _ := newNode(t, bus, 3, 8)
+	var ids []uint32
+	var times []canard.Microsecond
+	bus.Trace = func(ts canard.Microsecond, from *Node, frame canard.Frame) {
+		ids = append(ids, frame.ID())
+		times = append(times, ts)
+	}
+	// Node C receives messages from A and B.
+	var got [][]byte
+	var subs [2]canard.Sub
+	for i, subject := range []canard.PortID{100, 200} {
+		err := insC.Subscribe(canard.TxKindMessage, subject, 64, 1e6, &subs[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		subs[i].SetHandler(func(_ *canard.Sub, tx *canard.Transfer) {
+			got = append(got, append([]byte(nil), tx.Payload()...))
+		})
+	}
+	pubA, err := canard.NewPublisher(insA, qA, 100, canard.PriorityNominal, 1e6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubB, err := canard.NewPublisher(insB, qB, 200, canard.PriorityHigh, 1e6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	long := []byte("multi-frame message from node A")
+	if err = pubA.Publish(0, long); err != nil {
+		t.Fatal(err)
+	}
+	if err = pubB.Publish(0, []byte{1, 2, 3, 4, 5, 6, 7}); err != nil {
+		t.Fatal(err)
+	}
+	err = bus.Run(1e6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bus.Now() != 1e6 {
+		t.Error("expected time advanced to end of run, got", bus.Now())
+	}
+	// The high priority message of node B wins arbitration over the whole transfer of node A.
+	if len(ids) != 6 || ids[0]>>26 != uint32(canard.PriorityHigh) {
+		t.Fatalf("bad arbitration order %#x", ids)
+	}
+	for _, id := range ids[1:] {
+		if id>>26 != uint32(canard.PriorityNominal) {
+			t.Errorf("bad arbitration order %#x", ids)
+		}
+	}
+	// Full 8 byte classic frames take 131 bit times at 1Mbit/s.
+	if times[0] != 131 || times[1] != 262 {
+		t.Errorf("bad frame timestamps %d", times)
+	}
+	if len(got) != 2 || !bytes.Equal(got[0], []byte{1, 2, 3, 4, 5, 6, 7}) || !bytes.Equal(got[1], long) {
+		t.Errorf("bad transfers received %q", got)
+	}
+}
+
+func TestServiceCall(t *testing.T) {
+	bus := NewBus(1e6, 4e6)
+	insClient, qClient := newNode(t, bus, 10, 64)
+	insServer, qServer := newNode(t, bus, 20, 64)
+	_, err := canard.NewServer(insServer, qServer, 430, 64, 1e6, func(req *canard.Transfer) ([]byte, error) {
+		return append([]byte("echo: "), req.Payload()...), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := canard.NewClient(insClient, qClient, 430, 64, canard.PriorityNominal, 1e6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp []byte
+	_, err = client.Request(bus.Now(), 20, []byte("hello"), func(tx *canard.Transfer, err error) {
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		resp = append([]byte(nil), tx.Payload()...)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = bus.Run(1e6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(resp, []byte("echo: hello")) {
+		t.Errorf("bad response %q", resp)
+	}
+}
+
+func TestExpiredAndTooLong(t *testing.T) {
+	bus := NewBus(500e3, 0)
+	ins := &canard.Instance{NodeID: 1}
+	q := &canard.TxQueue{Cap: 64, MTU: 64}
+	node := bus.Attach(ins, q)
+	pub, err := canard.NewPublisher(ins, q, 100, canard.PriorityNominal, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = pub.Publish(0, []byte{1}); err != nil {
+		t.Fatal(err)
+	}
+	bus.Advance(100)
+	ok, err := bus.Step()
+	if ok || err != nil || node.Expired != 1 {
+		t.Errorf("expected expired frame to be purged, got %v %v %d", ok, err, node.Expired)
+	}
+	if err = pub.Publish(bus.Now(), make([]byte, 20)); err != nil {
+		t.Fatal(err)
+	}
+	ok, err = bus.Step()
+	if !ok || !errors.Is(err, ErrFrameTooLong) {
+		t.Error("expected ErrFrameTooLong, got", err)
+	}
+	if q.Peek() != nil {
+		t.Error("expected frame to be dropped")
+	}
+}
@@ -0,0 +1,294 @@
+// Package slcan implements a canard.Driver for adapters speaking the SLCAN
+// (Lawicel) ASCII protocol, usually over a serial port.
+package slcan
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	canard "github.com/soypat/go-canard"
+)
+
+var (
+	// ErrCommand is returned when the adapter rejects a command.
+	ErrCommand = errors.New("slcan: command rejected by adapter")
+	// ErrBitrate is returned by SetBitrate for bitrates without an SLCAN setup command.
+	ErrBitrate = errors.New("slcan: unsupported bitrate")
+)
+
+const (
+	cr  = '\r'
+	bel = '\a'
+	// Adapter timestamps are milliseconds which wrap around every minute.
+	timestampPeriod = 60000
+	// Longest line is an FD frame with 64 data bytes and a timestamp.
+	maxLine = 1 + 8 + 1 + 2*64 + 4
+)
+
+var dlcToLength = [16]int{0, 1, 2, 3, 4, 5, 6, 7, 8, 12, 16, 20, 24, 32, 48, 64}
+
+// Bitrates with an SLCAN setup command. The index is the command argument.
+var bitrates = [...]int{10e3, 20e3, 50e3, 100e3, 125e3, 250e3, 500e3, 800e3, 1e6}
+
+// Driver is a canard.Driver over an SLCAN adapter. Extended CAN frames are sent
+// with the T command and CAN FD frames with the D command, or B if BitrateSwitch is set.
+// Send may be called concurrently with Receive. Commands such as Open wait for the
+// adapter's response and must not be called concurrently with Receive.
+type Driver struct {
+	// BitrateSwitch sets whether FD frames are transmitted with bitrate switching.
+	BitrateSwitch bool
+	// Clock returns the reception timestamp of frames when adapter timestamps are off.
+	// Defaults to the microseconds elapsed since the Unix epoch.
+	Clock func() canard.Microsecond
+
+	rw io.ReadWriter
+	// Received bytes not yet parsed.
+	buf  [256]byte
+	r, w int
+	// Line being parsed.
+	line [maxLine]byte
+	n    int
+	// Skip bytes until the end of an overlong line.
+	discard bool
+	rxData  [64]byte
+	// Adapter timestamp unwrapping state.
+	lastStamp int
+	epoch     canard.Microsecond
+	stamped   bool
+}
+
+// New returns a driver which communicates with an SLCAN adapter over rw.
+// If reads from rw time out with os.ErrDeadlineExceeded, or an error whose
+// Timeout method returns true, Receive returns canard.ErrNoFrame.
+func New(rw io.ReadWriter) *Driver {
+	return &Driver{rw: rw}
+}
+
+// Open opens the CAN channel. The bitrate must be set beforehand.
+func (d *Driver) Open() error { return d.command("O") }
+
+// Close closes the CAN channel.
+func (d *Driver) Close() error { return d.command("C") }
+
+// SetBitrate sets the CAN bitrate in bits per second. It must be called with the channel closed.
+func (d *Driver) SetBitrate(bitrate int) error {
+	for i, b := range bitrates {
+		if b == bitrate {
+			return d.command("S" + strconv.Itoa(i))
+		}
+	}
+	return ErrBitrate
+}
+
+// SetTimestamps enables or disables adapter reception timestamps. Adapter timestamps
+// have millisecond resolution and are counted from an arbitrary instant.
+// It must be called with the channel closed.
+func (d *Driver) SetTimestamps(enable bool) error {
+	if enable {
+		return d.command("Z1")
+	}
+	return d.command("Z0")
+}
+
+// Send writes frame to the adapter. The deadline is not used.
+func (d *Driver) Send(deadline canard.Microsecond, frame canard.Frame) error {
+	data := frame.Data()
+	var buf [maxLine]byte
+	n := 0
+	switch {
+	case !frame.IsFD():
+		buf[0] = 'T'
+	case d.BitrateSwitch:
+		buf[0] = 'B'
+	default:
+		buf[0] = 'D'
+	}
+	n++
+	n += putHex(buf[n:n+8], frame.ID())
+	n += putHex(buf[n:n+1], uint32(frame.DLC()))
+	for _, b := range data {
+		n += putHex(buf[n:n+2], uint32(b))
+	}
+	buf[n] = cr
+	n++
+	_, err := d.rw.Write(buf[:n])
+	return err
+}
+
+// Receive reads lines from the adapter until an extended data frame is received
+// and returns it with its reception timestamp. Other lines, such as transmit
+// acknowledgements and standard frames, are skipped. The frame data is valid
+// until the next call to Receive.
+func (d *Driver) Receive() (canard.Frame, canard.Microsecond, error) {
+	for {
+		line, err := d.readLine()
+		if err != nil {
+			if isTimeout(err) {
+				return canard.Frame{}, 0, canard.ErrNoFrame
+			}
+			return canard.Frame{}, 0, err
+		}
+		frame, stamp, ok := d.parseFrame(line)
+		if !ok {
+			continue
+		}
+		if stamp < 0 {
+			return frame, d.now(), nil
+		}
+		return frame, d.unwrap(stamp), nil
+	}
+}
+
+// command writes cmd and waits for the adapter's response,
+// skipping any frames received in the meantime.
+func (d *Driver) command(cmd string) error {
+	_, err := d.rw.Write([]byte(cmd + "\r"))
+	if err != nil {
+		return err
+	}
+	for {
+		line, err := d.readLine()
+		if err != nil {
+			return err
+		}
+		switch {
+		case len(line) == 1 && line[0] == bel:
+			return ErrCommand
+		case len(line) == 0:
+			return nil
+		}
+	}
+}
+
+// readLine returns the next line without its carriage return. The adapter's error
+// response, a bell character, is returned as a line holding the bell character.
+// Partially read lines are kept between calls that return errors.
+func (d *Driver) readLine() ([]byte, error) {
+	for {
+		for d.r < d.w {
+			c := d.buf[d.r]
+			d.r++
+			switch {
+			case c == cr || c == bel:
+				n := d.n
+				d.n = 0
+				if d.discard {
+					d.discard = false
+					continue
+				}
+				if c == bel {
+					d.line[0] = bel
+					n = 1
+				}
+				return d.line[:n], nil
+			case d.n >= len(d.line):
+				d.discard = true
+			default:
+				d.line[d.n] = c
+				d.n++
+			}
+		}
+		read, err := d.rw.Read(d.buf[:])
+		d.r, d.w = 0, read
+		if err != nil && read == 0 {
+			return nil, err
+		}
+	}
+}
+
+// parseFrame parses an extended frame line. stamp is negative if the line has no timestamp.
+func (d *Driver) parseFrame(line []byte) (frame canard.Frame, stamp int, ok bool) {
+	if len(line) < 10 || (line[0] != 'T' && line[0] != 'D' && line[0] != 'B') {
+		return frame, 0, false
+	}
+	id, ok1 := parseHex(line[1:9])
+	dlc, ok2 := parseHex(line[9:10])
+	if !ok1 || !ok2 || (line[0] == 'T' && dlc > 8) {
+		return frame, 0, false
+	}
+	length := dlcToLength[dlc]
+	rest := line[10:]
+	if len(rest) < 2*length {
+		return frame, 0, false
+	}
+	for i := 0; i < length; i++ {
+		b, ok := parseHex(rest[2*i : 2*i+2])
+		if !ok {
+			return frame, 0, false
+		}
+		d.rxData[i] = byte(b)
+	}
+	rest = rest[2*length:]
+	stamp = -1
+	switch len(rest) {
+	case 0:
+	case 4:
+		s, ok := parseHex(rest)
+		if !ok || s >= timestampPeriod {
+			return frame, 0, false
+		}
+		stamp = int(s)
+	default:
+		return frame, 0, false
+	}
+	frame, err := canard.NewFrame(id, d.rxData[:length])
+	if err != nil {
+		return frame, 0, false
+	}
+	return frame, stamp, true
+}
+
+// unwrap converts an adapter timestamp in milliseconds, which wraps around every
+// minute, to a monotonic timestamp. Frames must be received at least once a minute
+// for the result to be correct.
+func (d *Driver) unwrap(stamp int) canard.Microsecond {
+	if d.stamped && stamp < d.lastStamp {
+		d.epoch += timestampPeriod * 1000
+	}
+	d.stamped = true
+	d.lastStamp = stamp
+	return d.epoch + canard.Microsecond(stamp)*1000
+}
+
+func (d *Driver) now() canard.Microsecond {
+	if d.Clock != nil {
+		return d.Clock()
+	}
+	return canard.Microsecond(time.Now().UnixMicro())
+}
+
+func isTimeout(err error) bool {
+	var timeout interface{ Timeout() bool }
+	return errors.Is(err, os.ErrDeadlineExceeded) || (errors.As(err, &timeout) && timeout.Timeout())
+}
+
+const hexDigits = "0123456789ABCDEF"
+
+// putHex writes v as len(dst) uppercase hex digits.
+func putHex(dst []byte, v uint32) int {
+	for i := len(dst) - 1; i >= 0; i-- {
+		dst[i] = hexDigits[v&0xf]
+		v >>= 4
+	}
+	return len(dst)
+}
+
+func parseHex(src []byte) (v uint32, ok bool) {
+	for _, c := range src {
+		switch {
+		case c >= '0' && c <= '9':
+			c -= '0'
+		case c >= 'A' && c <= 'F':
+			c -= 'A' - 10
+		case c >= 'a' && c <= 'f':
+			c -= 'a' - 10
+		default:
+			return 0, false
+		}
+		v = v<<4 | uint32(c)
+	}
+	return v, true
+}
@@ -0,0 +1,184 @@
+package slcan
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	canard "github.com/soypat/go-canard"
+)
+
+// adapter emulates an SLCAN adapter on conn, acknowledging commands and
+// recording them. Lines in frames are sent once the channel is opened.
+// The setup command of the 10kbit/s bitrate is rejected.
+func adapter(conn net.Conn, frames string) <-chan []string {
+	done := make(chan []string, 1)
+	go func() {
+		var cmds []string
+		buf := make([]byte, 256)
+		var line []byte
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				done <- cmds
+				return
+			}
+			for _, c := range buf[:n] {
+				if c != '\r' {
+					line = append(line, c)
+					continue
+				}
+				cmd := string(line)
+				line = line[:0]
+				cmds = append(cmds, cmd)
+				reply := "\r"
+				switch {
+				case cmd == "O":
+					reply += frames
+				case cmd == "S0":
+					reply = "\a"
+				}
+				conn.Write([]byte(reply))
+			}
+		}
+	}()
+	return done
+}
+
+func TestCommandsAndReceive(t *testing.T) {
+	host, dev := net.Pipe()
+	const frames = "t12320102\r" + // Standard frame is skipped.
+		"T107D552A4010203E0EA5F\r" + // Timestamp 59999ms.
+		"Z\r" + // Transmit acknowledgement is skipped.
+		"D107D552AA" + "000102030405060708090A0B0C0D0E0F" + "000A\r" // FD frame, timestamp wrapped to 10ms.
+	cmds := adapter(dev, frames)
+	d := New(host)
+	if err := d.SetBitrate(1e6); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetBitrate(1e3); !errors.Is(err, ErrBitrate) {
+		t.Error("expected ErrBitrate, got", err)
+	}
+	if err := d.SetBitrate(10e3); !errors.Is(err, ErrCommand) {
+		t.Error("expected ErrCommand, got", err)
+	}
+	if err := d.SetTimestamps(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Open(); err != nil {
+		t.Fatal(err)
+	}
+	frame, ts, err := d.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame.ID() != 0x107d552a || !bytes.Equal(frame.Data(), []byte{1, 2, 3, 0xe0}) {
+		t.Errorf("bad frame %#x %x", frame.ID(), frame.Data())
+	}
+	if ts != 59999e3 {
+		t.Error("bad timestamp", ts)
+	}
+	frame, ts, err = d.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append([]byte{}, 0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15)
+	if frame.ID() != 0x107d552a || !frame.IsFD() || !bytes.Equal(frame.Data(), want) {
+		t.Errorf("bad FD frame %#x %x", frame.ID(), frame.Data())
+	}
+	if ts != 60010e3 {
+		t.Error("bad unwrapped timestamp", ts)
+	}
+	host.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	_, _, err = d.Receive()
+	if !errors.Is(err, canard.ErrNoFrame) {
+		t.Error("expected ErrNoFrame, got", err)
+	}
+	host.SetReadDeadline(time.Time{})
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	host.Close()
+	got := <-cmds
+	expect := []string{"S8", "S0", "Z1", "O", "C"}
+	if len(got) != len(expect) {
+		t.Fatalf("got commands %q, want %q", got, expect)
+	}
+	for i := range got {
+		if got[i] != expect[i] {
+			t.Errorf("got commands %q, want %q", got, expect)
+			break
+		}
+	}
+}
+
+func TestSendReceive(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	tx, rx := New(a), New(b)
+	tx.BitrateSwitch = true
+	rx.Clock = func() canard.Microsecond { return 1234 }
+
+	// Send a multi-frame transfer from a queue and reassemble it.
+	q := canard.TxQueue{Cap: 16, MTU: 64}
+	meta := canard.Metadata{Priority: canard.PriorityNominal, TxKind: canard.TxKindMessage, Port: 1234, TID: 3}
+	meta.Remote.Unset()
+	payload := bytes.Repeat([]byte("slcan"), 20)
+	if err := q.Push(42, 1e6, &meta, len(payload), payload); err != nil {
+		t.Fatal(err)
+	}
+	errc := make(chan error, 1)
+	go func() {
+		_, _, err := q.Pump(0, tx)
+		errc <- err
+	}()
+	var ins canard.Instance
+	var sub canard.Sub
+	if err := ins.Subscribe(canard.TxKindMessage, 1234, 128, 1e6, &sub); err != nil {
+		t.Fatal(err)
+	}
+	var transfer canard.Transfer
+	for {
+		frame, ts, err := rx.Receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ts != 1234 {
+			t.Error("bad timestamp", ts)
+		}
+		_, err = ins.Accept(ts, &frame, 0, &transfer)
+		if errors.Is(err, canard.ErrTransferPending) {
+			continue
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		break
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	// Last FD frame is padded.
+	if !bytes.HasPrefix(transfer.Payload(), payload) {
+		t.Errorf("got payload %q", transfer.Payload())
+	}
+}
+
+func TestLineTooLong(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	d := New(b)
+	go func() {
+		a.Write(bytes.Repeat([]byte{'T'}, 2*maxLine))
+		a.Write([]byte("\rT107D552A1E0\r"))
+	}()
+	frame, _, err := d.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame.ID() != 0x107d552a || !bytes.Equal(frame.Data(), []byte{0xe0}) {
+		t.Errorf("bad frame %#x %x", frame.ID(), frame.Data())
+	}
+}
@@ -0,0 +1,4 @@
+// Package socketcan implements a canard.Driver over a Linux SocketCAN interface
+// using raw AF_CAN sockets. It supports classic and FD frames, kernel reception
+// timestamps and hardware acceptance filters. The driver is only available on Linux.
+package socketcan
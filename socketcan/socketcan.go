@@ -0,0 +1,229 @@
+//go:build linux
+
+package socketcan
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"time"
+	"unsafe"
+
+	canard "github.com/soypat/go-canard"
+)
+
+// Linux SocketCAN constants from linux/can.h and linux/can/raw.h.
+const (
+	canRaw          = 1
+	solCANRaw       = 101
+	canRawFilter    = 1
+	canRawFDFrames  = 5
+	canEFFFlag      = 0x80000000
+	canRTRFlag      = 0x40000000
+	canErrFlag      = 0x20000000
+	canEFFMask      = 0x1fffffff
+	canfdBRS        = 0x01
+	canMTU          = 16
+	canfdMTU        = 72
+	sizeofSockaddr  = 24
+	frameHeaderSize = 8
+)
+
+// DefaultReadTimeout is the time Receive waits for a frame before returning canard.ErrNoFrame.
+const DefaultReadTimeout = 100 * time.Millisecond
+
+// Driver is a canard.Driver over a SocketCAN interface. Send and Receive
+// may be called concurrently.
+type Driver struct {
+	sock int
+	// Whether CAN FD frames are enabled.
+	fd bool
+	// Buffers of the last frame received and its control messages.
+	rxBuf [canfdMTU]byte
+	oob   [64]byte
+}
+
+// Open opens a raw CAN socket bound to the interface named iface, e.g. "can0" or "vcan0".
+// If fd is true CAN FD frames may be sent and received, which the interface must support.
+// Receive waits up to readTimeout for a frame, or DefaultReadTimeout if readTimeout is zero.
+func Open(iface string, fd bool, readTimeout time.Duration) (*Driver, error) {
+	ifi, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, err
+	}
+	sock, err := syscall.Socket(syscall.AF_CAN, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, canRaw)
+	if err != nil {
+		return nil, err
+	}
+	d := &Driver{sock: sock, fd: fd}
+	err = d.init(ifi.Index, readTimeout)
+	if err != nil {
+		syscall.Close(sock)
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *Driver) init(ifindex int, readTimeout time.Duration) error {
+	if d.fd {
+		err := syscall.SetsockoptInt(d.sock, solCANRaw, canRawFDFrames, 1)
+		if err != nil {
+			return err
+		}
+	}
+	err := syscall.SetsockoptInt(d.sock, syscall.SOL_SOCKET, syscall.SO_TIMESTAMP, 1)
+	if err != nil {
+		return err
+	}
+	if readTimeout <= 0 {
+		readTimeout = DefaultReadTimeout
+	}
+	tv := syscall.NsecToTimeval(readTimeout.Nanoseconds())
+	err = syscall.SetsockoptTimeval(d.sock, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv)
+	if err != nil {
+		return err
+	}
+	// Receive all extended data frames until filters are set.
+	err = d.SetFilters([]canard.Filter{{}})
+	if err != nil {
+		return err
+	}
+	// struct sockaddr_can with family and interface index set.
+	var addr [sizeofSockaddr]byte
+	*(*uint16)(unsafe.Pointer(&addr[0])) = syscall.AF_CAN
+	*(*int32)(unsafe.Pointer(&addr[4])) = int32(ifindex)
+	_, _, errno := syscall.Syscall(syscall.SYS_BIND, uintptr(d.sock), uintptr(unsafe.Pointer(&addr[0])), sizeofSockaddr)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// Close closes the socket.
+func (d *Driver) Close() error {
+	return syscall.Close(d.sock)
+}
+
+// Send writes frame to the socket without blocking. It returns canard.ErrDriverBusy
+// if the interface's transmit queue is full. The deadline is not used since the
+// kernel does not support transmission deadlines.
+func (d *Driver) Send(deadline canard.Microsecond, frame canard.Frame) error {
+	data := frame.Data()
+	var buf [canfdMTU]byte
+	size := canMTU
+	if frame.IsFD() {
+		if !d.fd {
+			return canard.ErrInvalidDLC
+		}
+		size = canfdMTU
+		buf[5] = canfdBRS
+	}
+	*(*uint32)(unsafe.Pointer(&buf[0])) = frame.ID() | canEFFFlag
+	buf[4] = byte(len(data))
+	copy(buf[frameHeaderSize:], data)
+	err := syscall.Sendto(d.sock, buf[:size], syscall.MSG_DONTWAIT, nil)
+	if errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.ENOBUFS) {
+		return canard.ErrDriverBusy
+	}
+	return err
+}
+
+// Receive returns the next extended frame received and its kernel timestamp in
+// microseconds since the Unix epoch. It returns canard.ErrNoFrame if no frame is
+// received within the read timeout. The frame data is valid until the next call to Receive.
+func (d *Driver) Receive() (canard.Frame, canard.Microsecond, error) {
+	for {
+		n, oobn, err := d.recvmsg()
+		if errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EINTR) {
+			return canard.Frame{}, 0, canard.ErrNoFrame
+		} else if err != nil {
+			return canard.Frame{}, 0, err
+		}
+		if n != canMTU && n != canfdMTU {
+			continue // Not a CAN frame.
+		}
+		id := *(*uint32)(unsafe.Pointer(&d.rxBuf[0]))
+		if id&canEFFFlag == 0 || id&(canRTRFlag|canErrFlag) != 0 {
+			continue // Cyphal uses extended data frames only.
+		}
+		length := int(d.rxBuf[4])
+		if frameHeaderSize+length > n {
+			continue
+		}
+		frame, err := canard.NewFrame(id&canEFFMask, d.rxBuf[frameHeaderSize:frameHeaderSize+length])
+		if err != nil {
+			continue
+		}
+		return frame, d.timestamp(oobn), nil
+	}
+}
+
+// SetFilters sets the interface's acceptance filters. Only extended data frames
+// accepted by any of the filters are received. No frames are received if filters is empty.
+func (d *Driver) SetFilters(filters []canard.Filter) error {
+	// struct can_filter
+	type canFilter struct {
+		id   uint32
+		mask uint32
+	}
+	cf := make([]canFilter, len(filters))
+	for i, f := range filters {
+		cf[i] = canFilter{
+			id:   f.ID&canEFFMask | canEFFFlag,
+			mask: f.Mask&canEFFMask | canEFFFlag | canRTRFlag,
+		}
+	}
+	var ptr unsafe.Pointer
+	if len(cf) > 0 {
+		ptr = unsafe.Pointer(&cf[0])
+	}
+	_, _, errno := syscall.Syscall6(syscall.SYS_SETSOCKOPT, uintptr(d.sock), solCANRaw, canRawFilter,
+		uintptr(ptr), uintptr(len(cf))*unsafe.Sizeof(canFilter{}), 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// SetFiltersFrom sets up to n acceptance filters covering the subscriptions of ins.
+func (d *Driver) SetFiltersFrom(ins *canard.Instance, n int) error {
+	filters, err := ins.Filters(n)
+	if err != nil {
+		return err
+	}
+	return d.SetFilters(filters)
+}
+
+// recvmsg reads a frame into rxBuf and its control messages into oob.
+// syscall.Recvmsg is not used since it does not support AF_CAN addresses.
+func (d *Driver) recvmsg() (n, oobn int, err error) {
+	var iov syscall.Iovec
+	iov.Base = &d.rxBuf[0]
+	iov.SetLen(len(d.rxBuf))
+	var msg syscall.Msghdr
+	msg.Iov = &iov
+	msg.Iovlen = 1
+	msg.Control = &d.oob[0]
+	msg.SetControllen(len(d.oob))
+	r, _, errno := syscall.Syscall(syscall.SYS_RECVMSG, uintptr(d.sock), uintptr(unsafe.Pointer(&msg)), 0)
+	if errno != 0 {
+		return 0, 0, errno
+	}
+	return int(r), int(msg.Controllen), nil
+}
+
+// timestamp returns the kernel reception timestamp in the control messages
+// or the current time if there is none.
+func (d *Driver) timestamp(oobn int) canard.Microsecond {
+	msgs, err := syscall.ParseSocketControlMessage(d.oob[:oobn])
+	if err == nil {
+		for _, m := range msgs {
+			if m.Header.Level == syscall.SOL_SOCKET && m.Header.Type == syscall.SCM_TIMESTAMP &&
+				len(m.Data) >= int(unsafe.Sizeof(syscall.Timeval{})) {
+				tv := (*syscall.Timeval)(unsafe.Pointer(&m.Data[0]))
+				return canard.Microsecond(tv.Nano() / 1e3)
+			}
+		}
+	}
+	return canard.Microsecond(time.Now().UnixMicro())
+}
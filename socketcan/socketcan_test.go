@@ -0,0 +1,123 @@
+//go:build linux
+
+package socketcan
+
+import (
+	"bytes"
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+
+	canard "github.com/soypat/go-canard"
+)
+
+const testInterface = "vcan0"
+
+// openPair opens two sockets on the test interface. Frames sent on one are received by the other.
+func openPair(t *testing.T, fd bool) (a, b *Driver) {
+	t.Helper()
+	a, err := Open(testInterface, fd, 10*time.Millisecond)
+	if err != nil {
+		t.Skipf("%s not available: %v", testInterface, err)
+	}
+	t.Cleanup(func() { a.Close() })
+	b, err = Open(testInterface, fd, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return a, b
+}
+
+func receive(t *testing.T, d *Driver) (canard.Frame, canard.Microsecond) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		frame, ts, err := d.Receive()
+		if errors.Is(err, canard.ErrNoFrame) {
+			continue
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		return frame, ts
+	}
+	t.Fatal("timed out receiving frame")
+	return canard.Frame{}, 0
+}
+
+func TestSendReceive(t *testing.T) {
+	a, b := openPair(t, false)
+	sent, err := canard.NewFrame(0x107d552a, []byte{1, 2, 3, 0xe0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := canard.Microsecond(time.Now().UnixMicro())
+	err = a.Send(0, sent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ts := receive(t, b)
+	if got.ID() != sent.ID() || !bytes.Equal(got.Data(), sent.Data()) {
+		t.Errorf("got frame %#x %v, want %#x %v", got.ID(), got.Data(), sent.ID(), sent.Data())
+	}
+	if ts < start-1e6 || ts > start+1e6 {
+		t.Errorf("bad kernel timestamp %d, sent at %d", ts, start)
+	}
+	_, _, err = b.Receive()
+	if !errors.Is(err, canard.ErrNoFrame) {
+		t.Error("expected ErrNoFrame, got", err)
+	}
+}
+
+func TestSendReceiveFD(t *testing.T) {
+	a, b := openPair(t, true)
+	data := make([]byte, 64)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	sent, err := canard.NewFrame(0x107d552a, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.Send(0, sent)
+	if errors.Is(err, syscall.EINVAL) {
+		t.Skip("interface does not support CAN FD")
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := receive(t, b)
+	if got.ID() != sent.ID() || !bytes.Equal(got.Data(), sent.Data()) {
+		t.Errorf("got frame %#x %v, want %#x %v", got.ID(), got.Data(), sent.ID(), sent.Data())
+	}
+}
+
+func TestFilters(t *testing.T) {
+	a, b := openPair(t, false)
+	var ins canard.Instance
+	var sub canard.Sub
+	err := ins.Subscribe(canard.TxKindMessage, 1234, 8, 1e6, &sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.SetFiltersFrom(&ins, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accepted := canard.FilterForSubject(1234).ID | 42
+	rejected := canard.FilterForSubject(1235).ID | 42
+	for _, id := range []uint32{rejected, accepted} {
+		frame, err := canard.NewFrame(id, []byte{0xe0})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = a.Send(0, frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, _ := receive(t, b)
+	if got.ID() != accepted {
+		t.Errorf("got frame %#x, want %#x", got.ID(), accepted)
+	}
+}
@@ -7,18 +7,30 @@ import (
 
 // Contains OpenCyphal transmission/transfer logic.
 
-func (q *TxQueue) Push(src NodeID, txDeadline microsecond, metadata *Metadata, payloadSize int, payload []byte) error {
+// Push enqueues a transfer from node src to be transmitted before txDeadline.
+// It returns ErrTxQueueFull, leaving the queue untouched, if the transfer's
+// frames would exceed the queue capacity.
+func (q *TxQueue) Push(src NodeID, txDeadline Microsecond, metadata *Metadata, payloadSize int, payload []byte) error {
 	switch {
 	case q == nil || metadata == nil:
 		return ErrInvalidArgument
 	case len(payload) == 0 && payloadSize != 0:
 		return errEmptyPayload
+	case metadata.TID > TRANSFER_ID_MAX:
+		return ErrBadTransferID
 	}
 	pl_mtu := adjustPresentationLayerMTU(q.MTU)
 	maybeCan, err := metadata.makeCANID(payloadSize, payload, src, pl_mtu)
 	if err != nil {
 		return err
 	}
+	numFrames := 1
+	if payloadSize > pl_mtu {
+		numFrames = (payloadSize + int(unsafe.Sizeof(CRC(0))) + pl_mtu - 1) / pl_mtu
+	}
+	if q.size+numFrames > q.Cap {
+		return ErrTxQueueFull
+	}
 	if payloadSize > pl_mtu {
 		_, err := q.pushMultiFrame(txDeadline, maybeCan, metadata.TID, pl_mtu, payloadSize, payload)
 		return err
@@ -38,6 +50,38 @@ func (q *TxQueue) Peek() *TxQueueItem {
 	return (*TxQueueItem)(unsafe.Pointer(tqi))
 }
 
+// Free hands a popped item back to the queue so that its memory may be reused.
+// The item and its frame data must not be used after calling Free.
+func (q *TxQueue) Free(item *TxQueueItem) {
+	if item == nil {
+		return
+	}
+	tqi := (*TxItem)(unsafe.Pointer(item))
+	q.memory().Free(tqi.payloadBuffer)
+	*tqi = TxItem{}
+	if q.spare != nil {
+		tqi.base.nextInTx = &q.spare.base
+	}
+	q.spare = tqi
+	q.numSpare++
+}
+
+// Reserve preallocates items so that n frames can be queued without allocating on
+// the Go heap, counting frames queued and items freed for reuse. Once reserved, pushes
+// needing more items than are available fail with ErrOutOfMemory instead of allocating.
+// Items popped and not yet freed are unavailable.
+func (q *TxQueue) Reserve(n int) {
+	q.reserved = true
+	need := n - q.size - q.numSpare
+	if need <= 0 {
+		return
+	}
+	items := make([]TxItem, need)
+	for i := range items {
+		q.Free(&items[i].base)
+	}
+}
+
 // Pop removes item from the TxQueue and returns the removed item.
 // If item is nil then the first item is removed from the Queue and returned.
 func (q *TxQueue) Pop(item *TxQueueItem) *TxQueueItem {
@@ -52,6 +96,63 @@ func (q *TxQueue) Pop(item *TxQueueItem) *TxQueueItem {
 	return item
 }
 
+// Purge removes all frames whose deadline has passed along with the remaining frames
+// of their transfers so that incomplete transfers are never transmitted.
+// It returns the number of frames and transfers removed. Purge does not allocate.
+func (q *TxQueue) Purge(now Microsecond) (frames, transfers int) {
+	n := findExtremum(q.root, false)
+	for n != nil {
+		tqi := (*TxQueueItem)(unsafe.Pointer(n))
+		if tqi.deadline >= now {
+			n = successor(n)
+			continue
+		}
+		// Frames of a transfer share their deadline and CAN ID so the first expired frame
+		// found is the first queued frame of its transfer, the rest are linked to it.
+		canID, seq := tqi.frame.extendedCANID, tqi.seq
+		for tqi != nil {
+			next := tqi.nextInTx
+			remove(&q.root, &tqi.base)
+			q.size--
+			q.Free(tqi)
+			frames++
+			if next != nil && !q.contains(next) {
+				next = nil
+			}
+			tqi = next
+		}
+		transfers++
+		// Removal rebalances the tree, resume after the removed frame.
+		n = q.firstAfter(canID, seq)
+	}
+	return frames, transfers
+}
+
+// contains reports whether item is in the queue.
+func (q *TxQueue) contains(item *TxQueueItem) bool {
+	for n := q.root; n != nil; {
+		if n == &item.base {
+			return true
+		}
+		n = n.lr[b2i(predicateTx(item, n) > 0)]
+	}
+	return false
+}
+
+// firstAfter returns the first frame in transmission order after a frame with canID and seq.
+func (q *TxQueue) firstAfter(canID uint32, seq uint64) (out *TreeNode) {
+	for n := q.root; n != nil; {
+		tqi := (*TxQueueItem)(unsafe.Pointer(n))
+		if tqi.frame.extendedCANID > canID || (tqi.frame.extendedCANID == canID && tqi.seq > seq) {
+			out = n
+			n = n.lr[0]
+		} else {
+			n = n.lr[1]
+		}
+	}
+	return out
+}
+
 // / Chain of TX frames prepared for insertion into a TX queue.
 type txChain struct {
 	head *TxItem
@@ -71,7 +172,7 @@ func adjustPresentationLayerMTU(mtuBytes int) (mtu int) {
 	return mtu - 1
 }
 
-func (q *TxQueue) pushMultiFrame(deadline microsecond, canID uint32, tid TID, pl_mtu, payloadSize int, payload []byte) (int, error) {
+func (q *TxQueue) pushMultiFrame(deadline Microsecond, canID uint32, tid TID, pl_mtu, payloadSize int, payload []byte) (int, error) {
 	switch {
 	case len(payload) == 0 && payloadSize != 0:
 		return 0, errEmptyPayload
@@ -84,9 +185,12 @@ func (q *TxQueue) pushMultiFrame(deadline microsecond, canID uint32, tid TID, pl
 		panic("unreachable: pushMultiframe used for single frame transport")
 	}
 	if q.size+numFrames > q.Cap {
-		panic("OOM: tx queue capacity cannot fit multiframe transport")
+		return 0, ErrTxQueueFull
+	}
+	sq, err := q.generateMultiFrameChain(deadline, canID, tid, pl_mtu, payloadSize, payload)
+	if err != nil {
+		return 0, err
 	}
-	sq := generateMultiFrameChain(deadline, canID, tid, pl_mtu, payloadSize, payload)
 	if sq.tail == nil {
 		panic("nil tail")
 	} else if sq.head == nil {
@@ -94,6 +198,8 @@ func (q *TxQueue) pushMultiFrame(deadline microsecond, canID uint32, tid TID, pl
 	}
 	next := &sq.head.base
 	for next != nil {
+		q.seq++
+		next.seq = q.seq
 		res, err := search(&q.root, &next.base, predicateTx, avlTrivialFactory)
 		if err != nil {
 			return 0, err
@@ -111,7 +217,7 @@ func (q *TxQueue) pushMultiFrame(deadline microsecond, canID uint32, tid TID, pl
 	return out, nil
 }
 
-func generateMultiFrameChain(deadline microsecond, canID uint32, tid TID, pl_mtu, payloadSize int, payload []byte) txChain {
+func (q *TxQueue) generateMultiFrameChain(deadline Microsecond, canID uint32, tid TID, pl_mtu, payloadSize int, payload []byte) (txChain, error) {
 	switch {
 	case pl_mtu <= 0:
 		panic("bad presentation layer MTU")
@@ -133,7 +239,16 @@ func generateMultiFrameChain(deadline microsecond, canID uint32, tid TID, pl_mtu
 		} else {
 			frameWithTailSize = pl_mtu + 1
 		}
-		tqi := newTxItem(deadline, frameWithTailSize, canID)
+		tqi, err := q.newTxItem(deadline, frameWithTailSize, canID)
+		if err != nil {
+			// Free frames generated so far.
+			for item := chain.head; item != nil; {
+				next := (*TxItem)(unsafe.Pointer(item.base.nextInTx))
+				q.Free(&item.base)
+				item = next
+			}
+			return txChain{}, err
+		}
 		if chain.head == nil {
 			chain.head = tqi
 		} else {
@@ -184,10 +299,10 @@ func generateMultiFrameChain(deadline microsecond, canID uint32, tid TID, pl_mtu
 		chain.tail.payloadBuffer[frameOffset] = tailByte(chain.head == chain.tail, offset >= payloadSizeWithCRC, toggle, tid)
 		toggle = !toggle
 	}
-	return chain
+	return chain, nil
 }
 
-func (q *TxQueue) pushSingleFrame(deadline microsecond, canID uint32, tid TID, payloadSize int, payload []byte) error {
+func (q *TxQueue) pushSingleFrame(deadline Microsecond, canID uint32, tid TID, payloadSize int, payload []byte) error {
 	framePayloadSize := roundPayloadSizeUp(payloadSize + 1)
 	padding := framePayloadSize - payloadSize - 1
 	switch {
@@ -198,12 +313,24 @@ func (q *TxQueue) pushSingleFrame(deadline microsecond, canID uint32, tid TID, p
 	case padding+payloadSize+1 != framePayloadSize:
 		panic("overflow")
 	}
-	tqi := newTxItem(deadline, framePayloadSize, canID)
+	if q.size+1 > q.Cap {
+		return ErrTxQueueFull
+	}
+	tqi, err := q.newTxItem(deadline, framePayloadSize, canID)
+	if err != nil {
+		return err
+	}
 	if payloadSize > 0 {
 		copy(tqi.payloadBuffer[:], payload[:payloadSize])
 	}
+	// Reused buffers hold stale data, clear padding.
+	for i := payloadSize; i < framePayloadSize-1; i++ {
+		tqi.payloadBuffer[i] = 0
+	}
 	// Set tail byte.
 	tqi.payloadBuffer[framePayloadSize-1] = tailByte(true, true, true, tid)
+	q.seq++
+	tqi.base.seq = q.seq
 	res, err := search(&q.root, &tqi.base.base, predicateTx, avlTrivialFactory)
 	if err != nil {
 		return err
@@ -212,9 +339,6 @@ func (q *TxQueue) pushSingleFrame(deadline microsecond, canID uint32, tid TID, p
 		panic("bad AVL search result")
 	}
 	q.size++
-	if q.size > q.Cap {
-		panic("OOM on queue size exceed cap")
-	}
 	return nil
 }
 
@@ -230,16 +354,38 @@ func tailByte(start, end, toggle bool, tid TID) (tail byte) {
 	return tail
 }
 
-func newTxItem(deadline microsecond, size int, extendedCANID uint32) *TxItem {
-	tqi := &TxItem{
+func (q *TxQueue) newTxItem(deadline Microsecond, size int, extendedCANID uint32) (*TxItem, error) {
+	tqi := q.spare
+	if tqi == nil && q.reserved {
+		return nil, ErrOutOfMemory
+	}
+	buf, err := q.memory().Allocate(size)
+	if err != nil {
+		return nil, err
+	}
+	if tqi != nil {
+		q.spare = (*TxItem)(unsafe.Pointer(tqi.base.nextInTx))
+		q.numSpare--
+	} else {
+		tqi = &TxItem{}
+	}
+	*tqi = TxItem{
 		base: TxQueueItem{
 			deadline: deadline,
 			frame: Frame{
 				payloadSize:   size,
 				extendedCANID: extendedCANID,
+				payload:       buf,
 			},
 		},
+		payloadBuffer: buf,
+	}
+	return tqi, nil
+}
+
+func (q *TxQueue) memory() MemoryResource {
+	if q.Memory != nil {
+		return q.Memory
 	}
-	tqi.base.frame.payload = tqi.payloadBuffer[:]
-	return tqi
+	return &q.heap
 }
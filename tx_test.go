@@ -1,6 +1,10 @@
 package canard
 
-import "testing"
+import (
+	"errors"
+	"testing"
+	"unsafe"
+)
 
 func TestInstanceSingleAndMultiTx(t *testing.T) {
 	const (
@@ -60,7 +64,7 @@ func TestInstanceSingleAndMultiTx(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if que.size != 3 || que.root.Height() != 3 {
+	if que.size != 3 || que.root.Height() != 2 { // 3 nodes in a balanced tree.
 		t.Fatal("size expected to be 3 after 1 single and 2 multi frames")
 	}
 	// Remove first item and validate it is the first item pushed onto queue.
@@ -114,3 +118,221 @@ func TestInstanceSingleAndMultiTx(t *testing.T) {
 		t.Error("got CRC not match expected", expectedCRC, redundantExpectedCRC, gotMultiCRC)
 	}
 }
+
+func TestTxQueuePurge(t *testing.T) {
+	que := TxQueue{
+		Cap: 200,
+		MTU: _MTU_CAN_CLASSIC,
+	}
+	payload := make([]byte, 40)
+	meta := Metadata{
+		Priority: PriorityNominal,
+		TxKind:   TxKindMessage,
+		Port:     321,
+		Remote:   0xff,
+	}
+	push := func(deadline Microsecond, prio Priority, payloadSize int) {
+		t.Helper()
+		meta.Priority = prio
+		meta.TID++
+		err := que.Push(42, deadline, &meta, payloadSize, payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	push(10, PriorityHigh, 4)     // Single frame.
+	push(20, PriorityFast, 40)    // 6 frames.
+	push(30, PriorityNominal, 40) // 6 frames.
+	push(40, PriorityNominal, 4)  // Single frame.
+	if que.size != 14 {
+		t.Fatal("expected 14 frames in queue, got", que.size)
+	}
+	frames, transfers := que.Purge(10)
+	if frames != 0 || transfers != 0 {
+		t.Fatal("no frames expected to be purged, got", frames, transfers)
+	}
+	// Partially send the multi-frame transfer.
+	first := que.Pop(nil)
+	if first.deadline != 20 || !first.TailByte().IsStart() {
+		t.Fatal("expected first frame of multi-frame transfer")
+	}
+	frames, transfers = que.Purge(25)
+	if frames != 6 || transfers != 2 {
+		t.Error("expected 6 frames and 2 transfers purged, got", frames, transfers)
+	}
+	if que.size != 7 {
+		t.Fatal("expected 7 frames left, got", que.size)
+	}
+	for que.Peek() != nil {
+		tqi := que.Pop(nil)
+		if tqi.deadline < 25 {
+			t.Error("expired frame in queue")
+		}
+	}
+	if que.root != nil {
+		t.Error("expected empty queue")
+	}
+}
+
+func TestTxQueuePurgeAllocs(t *testing.T) {
+	pool, err := NewPool(make([]byte, 64*_MTU_CAN_CLASSIC), _MTU_CAN_CLASSIC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	que := TxQueue{Cap: 64, MTU: _MTU_CAN_CLASSIC, Memory: pool}
+	meta := Metadata{Priority: PriorityNominal, TxKind: TxKindMessage, Port: 321, Remote: 0xff}
+	payload := make([]byte, 20) // 4 frames.
+	for i := 0; i < 10; i++ {
+		meta.TID = TID(i)
+		meta.Priority = Priority(i % 3)
+		// Interleave expired and live transfers.
+		err = que.Push(42, Microsecond(100*(i%2)), &meta, len(payload), payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	busy := &MemDriver{}
+	allocs := testing.AllocsPerRun(10, func() {
+		que.Pump(50, busy)
+	})
+	if allocs != 0 {
+		t.Error("expected Pump not to allocate, got", allocs)
+	}
+	if que.size != 20 || pool.InUse() != 20*_MTU_CAN_CLASSIC {
+		t.Fatal("expected 5 transfers left, got frames", que.size)
+	}
+	for tqi := que.Peek(); tqi != nil; tqi = que.Peek() {
+		if tqi.Deadline() != 100 {
+			t.Error("expired frame in queue")
+		}
+		que.Free(que.Pop(tqi))
+	}
+}
+
+func TestTxQueuePushErrors(t *testing.T) {
+	que := TxQueue{
+		Cap: 3,
+		MTU: _MTU_CAN_CLASSIC,
+	}
+	payload := make([]byte, 20)
+	meta := Metadata{
+		Priority: PriorityNominal,
+		TxKind:   TxKindMessage,
+		Port:     321,
+		Remote:   0xff,
+	}
+	err := que.Push(42, 0, &meta, 4, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Needs 4 frames.
+	err = que.Push(42, 0, &meta, 20, payload)
+	if !errors.Is(err, ErrTxQueueFull) {
+		t.Error("expected ErrTxQueueFull, got", err)
+	}
+	if que.size != 1 || que.root.Height() != 1 {
+		t.Error("queue modified on failed push")
+	}
+	err = que.Push(42, 0, &meta, 21, payload)
+	if !errors.Is(err, ErrInvalidArgument) {
+		t.Error("expected ErrInvalidArgument for short payload, got", err)
+	}
+	err = que.Push(42, 0, &meta, -1, payload)
+	if !errors.Is(err, ErrInvalidArgument) {
+		t.Error("expected ErrInvalidArgument for negative payload size, got", err)
+	}
+	meta.Remote = 10 // Messages have no destination.
+	err = que.Push(42, 0, &meta, 4, payload)
+	if !errors.Is(err, ErrInvalidArgument) {
+		t.Error("expected ErrInvalidArgument for invalid metadata, got", err)
+	}
+	meta.TxKind = numberOfTxKinds
+	err = que.Push(42, 0, &meta, 4, payload)
+	if !errors.Is(err, ErrTransferKind) {
+		t.Error("expected ErrTransferKind, got", err)
+	}
+	meta.TxKind = TxKindMessage
+	meta.Remote.Unset()
+	que.Cap = 1
+	err = que.Push(42, 0, &meta, 4, payload)
+	if !errors.Is(err, ErrTxQueueFull) {
+		t.Error("expected ErrTxQueueFull on single frame, got", err)
+	}
+	if que.size != 1 {
+		t.Error("queue modified on failed push")
+	}
+}
+
+func TestTxQueueFIFO(t *testing.T) {
+	que := TxQueue{
+		Cap: 200,
+		MTU: _MTU_CAN_CLASSIC,
+	}
+	payload := make([]byte, 30)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	meta := Metadata{
+		Priority: PriorityNominal,
+		TxKind:   TxKindMessage,
+		Port:     321,
+		Remote:   0xff,
+	}
+	// Interleave pushes of two multi-frame transfers on the same subject with
+	// single frame transfers of higher priority.
+	const numTransfers = 6
+	for i := 0; i < numTransfers; i++ {
+		meta.TID = TID(i)
+		if i%2 == 0 {
+			meta.Priority = PriorityNominal
+			err := que.Push(42, 0, &meta, len(payload), payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			meta.Priority = PriorityHigh
+			err := que.Push(42, 0, &meta, 1, payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// Frames with equal CAN ID are ordered by insertion sequence number.
+	var prev *TxQueueItem
+	for n := findExtremum(que.root, false); n != nil; n = successor(n) {
+		tqi := (*TxQueueItem)(unsafe.Pointer(n))
+		if prev != nil && prev.frame.extendedCANID == tqi.frame.extendedCANID {
+			if prev.seq >= tqi.seq {
+				t.Errorf("frames with CAN ID %#x out of sequence: %d before %d", tqi.frame.extendedCANID, prev.seq, tqi.seq)
+			}
+			if predicateTx(prev, &tqi.base) != -1 || predicateTx(tqi, &prev.base) != 1 {
+				t.Error("predicate does not order equal CAN IDs by sequence")
+			}
+		}
+		prev = tqi
+	}
+	var got []Tail
+	for que.Peek() != nil {
+		got = append(got, que.Pop(nil).TailByte())
+	}
+	// High priority single frames go first.
+	for i, tail := range got[:numTransfers/2] {
+		if !tail.IsStart() || !tail.IsEnd() || tail.TransferID() != TID(2*i+1) {
+			t.Errorf("frame %d: expected single frame transfer %d, got tail %b", i, 2*i+1, tail)
+		}
+	}
+	// Multi-frame transfers go out frame by frame in order pushed.
+	multi := got[numTransfers/2:]
+	const framesPerTransfer = 5
+	if len(multi) != framesPerTransfer*numTransfers/2 {
+		t.Fatal("bad number of multi-frame frames", len(multi))
+	}
+	for i, tail := range multi {
+		n := i % framesPerTransfer
+		wantTID := TID(2 * (i / framesPerTransfer))
+		if tail.TransferID() != wantTID || tail.IsStart() != (n == 0) ||
+			tail.IsEnd() != (n == framesPerTransfer-1) || tail.IsToggled() != (n%2 == 0) {
+			t.Errorf("frame %d: out of order tail %b", i, tail)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package udp
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+
+	canard "github.com/soypat/go-canard"
+)
+
+const (
+	// maxTransferSize bounds the memory held by a transfer being reassembled. The whole
+	// transfer is buffered to verify its CRC, so larger transfers are dropped.
+	maxTransferSize = 1 << 20
+	// DefaultMaxBuffered is the default limit of bytes buffered by a Reassembler.
+	DefaultMaxBuffered = 4 * maxTransferSize
+)
+
+// Transfer is a transfer received over Cyphal/UDP.
+type Transfer struct {
+	// Metadata of the transfer. Metadata.TID is unused, see TID.
+	Metadata canard.Metadata
+	TID      uint64
+	// Destination node of service transfers.
+	Destination canard.NodeID
+	// Timestamp of the first frame of the transfer received.
+	Timestamp canard.Microsecond
+	Payload   []byte
+}
+
+type sessionKey struct {
+	kind canard.TxKind
+	port canard.PortID
+	src  canard.NodeID
+	dst  canard.NodeID
+}
+
+type rxSession struct {
+	// Transfer being reassembled.
+	tid       uint64
+	pending   bool
+	timestamp canard.Microsecond
+	frames    map[uint32][]byte
+	eot       int64
+	size      int
+	// Last transfer received.
+	lastTID   uint64
+	received  bool
+	lastFrame canard.Microsecond
+}
+
+// Reassembler reassembles transfers from datagrams. Frames of a transfer may be
+// received in any order. Transfers from each source to each destination on each
+// port are deduplicated by transfer-ID, which must increase unless no frame is
+// received from the source for longer than the transfer-ID timeout. Sessions of
+// sources idle for longer than the timeout are freed by Accept.
+type Reassembler struct {
+	// Extent is the maximum payload size of transfers received; longer payloads are truncated.
+	Extent     int
+	TIDTimeout canard.Microsecond
+	// MaxBuffered limits the bytes of all transfers being reassembled.
+	// Frames exceeding it are dropped with canard.ErrOutOfMemory.
+	MaxBuffered int
+	sessions    map[sessionKey]*rxSession
+	buffered    int
+	lastCleanup canard.Microsecond
+}
+
+// NewReassembler returns a Reassembler of transfers truncated to extent bytes
+// buffering up to DefaultMaxBuffered bytes.
+func NewReassembler(extent int, tidTimeout canard.Microsecond) *Reassembler {
+	return &Reassembler{
+		Extent:      extent,
+		TIDTimeout:  tidTimeout,
+		MaxBuffered: DefaultMaxBuffered,
+		sessions:    make(map[sessionKey]*rxSession),
+	}
+}
+
+// CleanupSessions frees the sessions of sources which have not sent a frame within the
+// transfer-ID timeout, releasing partially received transfers. It returns the number
+// of sessions and bytes reclaimed.
+func (r *Reassembler) CleanupSessions(now canard.Microsecond) (sessions, bytes int) {
+	r.lastCleanup = now
+	for key, s := range r.sessions {
+		if now > s.lastFrame && now-s.lastFrame > r.TIDTimeout {
+			sessions++
+			bytes += r.discard(s)
+			delete(r.sessions, key)
+		}
+	}
+	return sessions, bytes
+}
+
+// Sessions returns the number of sessions and the bytes buffered by them.
+func (r *Reassembler) Sessions() (sessions, bytes int) {
+	return len(r.sessions), r.buffered
+}
+
+// Accept processes a datagram received at timestamp. A nil error means a transfer
+// was received and written to outTx, whose payload is owned by the caller.
+// Datagrams that did not complete a transfer return one of ErrHeader,
+// canard.ErrInvalidNodeID, canard.ErrTransferPending, canard.ErrDuplicateFrame,
+// canard.ErrTIDMismatch, canard.ErrOutOfMemory or canard.ErrCRCMismatch.
+func (r *Reassembler) Accept(timestamp canard.Microsecond, datagram []byte, outTx *Transfer) error {
+	h, err := ParseHeader(datagram)
+	if err != nil {
+		return err
+	}
+	data := datagram[HeaderSize:]
+	if timestamp > r.lastCleanup && timestamp-r.lastCleanup > r.TIDTimeout {
+		r.CleanupSessions(timestamp)
+	}
+	if h.Source.IsUnset() {
+		if h.TxKind != canard.TxKindMessage || h.Index != 0 || !h.EOT {
+			return ErrHeader
+		}
+		return r.complete(&h, timestamp, data, outTx)
+	}
+	if (h.TxKind == canard.TxKindMessage) != h.Destination.IsUnset() {
+		return ErrHeader
+	}
+	key := sessionKey{kind: h.TxKind, port: h.Port, src: h.Source, dst: h.Destination}
+	s := r.sessions[key]
+	if s == nil {
+		s = &rxSession{}
+		r.sessions[key] = s
+	}
+	timedOut := timestamp > s.lastFrame && timestamp-s.lastFrame > r.TIDTimeout
+	if !s.pending || h.TID != s.tid {
+		switch {
+		case timedOut:
+		case s.received && h.TID <= s.lastTID:
+			return canard.ErrDuplicateFrame
+		case s.pending && h.TID < s.tid:
+			return canard.ErrTIDMismatch
+		}
+		r.discard(s)
+		s.start(h.TID, timestamp)
+	}
+	s.lastFrame = timestamp
+	if _, dup := s.frames[h.Index]; dup {
+		return canard.ErrDuplicateFrame
+	}
+	if h.EOT {
+		if s.eot >= 0 && s.eot != int64(h.Index) {
+			r.discard(s)
+			return ErrHeader
+		}
+		s.eot = int64(h.Index)
+	}
+	if s.eot >= 0 && int64(h.Index) > s.eot {
+		r.discard(s)
+		return ErrHeader
+	}
+	if r.buffered+len(data) > r.MaxBuffered {
+		r.CleanupSessions(timestamp)
+	}
+	if s.size+len(data) > maxTransferSize || r.buffered+len(data) > r.MaxBuffered {
+		r.discard(s)
+		return canard.ErrOutOfMemory
+	}
+	s.size += len(data)
+	r.buffered += len(data)
+	s.frames[h.Index] = append([]byte(nil), data...)
+	if s.eot < 0 || int64(len(s.frames)) != s.eot+1 {
+		return canard.ErrTransferPending
+	}
+	// All frames received, reassemble in order.
+	stream := make([]byte, 0, s.size)
+	for i := uint32(0); i <= uint32(s.eot); i++ {
+		stream = append(stream, s.frames[i]...)
+	}
+	r.discard(s)
+	s.received = true
+	s.lastTID = h.TID
+	return r.complete(&h, s.timestamp, stream, outTx)
+}
+
+// complete verifies the transfer CRC at the end of stream and writes the transfer to outTx.
+func (r *Reassembler) complete(h *Header, timestamp canard.Microsecond, stream []byte, outTx *Transfer) error {
+	if len(stream) < crcSize {
+		return canard.ErrCRCMismatch
+	}
+	payload := stream[:len(stream)-crcSize]
+	if crc32.Checksum(payload, castagnoli) != binary.LittleEndian.Uint32(stream[len(payload):]) {
+		return canard.ErrCRCMismatch
+	}
+	if len(payload) > r.Extent {
+		payload = payload[:r.Extent]
+	}
+	*outTx = Transfer{
+		Metadata: canard.Metadata{
+			Priority: h.Priority,
+			TxKind:   h.TxKind,
+			Port:     h.Port,
+			Remote:   h.Source,
+		},
+		TID:         h.TID,
+		Destination: h.Destination,
+		Timestamp:   timestamp,
+		Payload:     append([]byte(nil), payload...),
+	}
+	return nil
+}
+
+// discard drops the transfer being reassembled by s and returns the bytes it buffered.
+func (r *Reassembler) discard(s *rxSession) int {
+	size := s.size
+	r.buffered -= size
+	s.pending = false
+	s.frames = nil
+	s.size = 0
+	return size
+}
+
+// start begins reassembly of transfer tid. Any incomplete transfer must be discarded beforehand.
+func (s *rxSession) start(tid uint64, timestamp canard.Microsecond) {
+	s.tid = tid
+	s.pending = true
+	s.timestamp = timestamp
+	s.frames = make(map[uint32][]byte)
+	s.eot = -1
+	s.size = 0
+}
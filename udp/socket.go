@@ -0,0 +1,95 @@
+package udp
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	canard "github.com/soypat/go-canard"
+)
+
+// Socket sends and receives Cyphal/UDP transfers over a packet connection.
+type Socket struct {
+	// NodeID is the source of transfers sent. Service transfers received
+	// are discarded unless addressed to NodeID.
+	NodeID canard.NodeID
+	// MTU is the maximum payload size of datagrams sent. Defaults to DefaultMTU.
+	MTU int
+	// Clock returns the current time used to timestamp datagrams received.
+	// Defaults to the microseconds elapsed since the Unix epoch.
+	Clock func() canard.Microsecond
+	rx    *Reassembler
+	conn  net.PacketConn
+	buf   []byte
+}
+
+// NewSocket returns a Socket of node id over conn receiving transfers truncated to extent bytes.
+func NewSocket(conn net.PacketConn, id canard.NodeID, extent int, tidTimeout canard.Microsecond) *Socket {
+	return &Socket{
+		NodeID: id,
+		rx:     NewReassembler(extent, tidTimeout),
+		conn:   conn,
+		buf:    make([]byte, 65536),
+	}
+}
+
+// ListenGroup returns a connection receiving the datagrams sent to the multicast group
+// on the network interface ifi. If ifi is nil the system's default interface is used.
+func ListenGroup(ifi *net.Interface, group *net.UDPAddr) (*net.UDPConn, error) {
+	return net.ListenMulticastUDP("udp4", ifi, group)
+}
+
+// Send sends a transfer to the multicast group of its subject or destination node.
+// See Segment for the use of meta and tid.
+func (s *Socket) Send(meta *canard.Metadata, tid uint64, payload []byte) error {
+	if meta == nil {
+		return canard.ErrInvalidArgument
+	}
+	return s.SendTo(GroupAddr(meta), meta, tid, payload)
+}
+
+// SendTo sends a transfer to addr.
+func (s *Socket) SendTo(addr net.Addr, meta *canard.Metadata, tid uint64, payload []byte) error {
+	datagrams, err := Segment(s.NodeID, meta, tid, payload, s.MTU)
+	if err != nil {
+		return err
+	}
+	for _, dg := range datagrams {
+		_, err = s.conn.WriteTo(dg, addr)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Receive reads datagrams until a transfer is received and written to outTx. Datagrams
+// rejected by the reassembler are discarded except for transfer CRC mismatches, which are
+// returned. Errors reading from the connection, such as deadline timeouts, are returned.
+func (s *Socket) Receive(outTx *Transfer) error {
+	for {
+		n, _, err := s.conn.ReadFrom(s.buf)
+		if err != nil {
+			return err
+		}
+		err = s.rx.Accept(s.now(), s.buf[:n], outTx)
+		switch {
+		case err == nil:
+			if outTx.Metadata.TxKind == canard.TxKindMessage || outTx.Destination == s.NodeID {
+				return nil
+			}
+		case errors.Is(err, canard.ErrCRCMismatch):
+			return err
+		}
+	}
+}
+
+// Close closes the underlying connection.
+func (s *Socket) Close() error { return s.conn.Close() }
+
+func (s *Socket) now() canard.Microsecond {
+	if s.Clock != nil {
+		return s.Clock()
+	}
+	return canard.Microsecond(time.Now().UnixMicro())
+}
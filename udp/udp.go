@@ -0,0 +1,218 @@
+// Package udp implements the Cyphal/UDP transport. Transfers are segmented into
+// datagrams, each starting with a 24 byte header protected by a CRC-16, and the
+// payload of a transfer is followed by a CRC-32C. Messages are sent to the multicast
+// group of their subject and service transfers to the group of their destination node.
+//
+// Transfer metadata is shared with the Cyphal/CAN transport through canard.Metadata,
+// except for the transfer-ID which is 64 bits wide. Node IDs are therefore limited to
+// those valid on Cyphal/CAN.
+package udp
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"net"
+
+	canard "github.com/soypat/go-canard"
+)
+
+const (
+	// Port is the UDP port of all Cyphal/UDP traffic.
+	Port = 9382
+	// HeaderSize is the size of the Cyphal/UDP frame header.
+	HeaderSize = 24
+	// DefaultMTU is the default maximum payload size of a datagram excluding the header.
+	DefaultMTU = 1408
+
+	headerVersion = 1
+	unsetNodeID   = 0xffff
+	crcSize       = 4
+	// Data specifier flags.
+	flagServiceNotMessage = 1 << 15
+	flagRequestNotResp    = 1 << 14
+	serviceIDMask         = 1<<14 - 1
+	frameIndexEOT         = 1 << 31
+)
+
+var (
+	// ErrHeader is returned for datagrams with a malformed or corrupted header.
+	ErrHeader = errors.New("udp: invalid frame header")
+	// ErrAnonymousMultiFrame is returned when segmenting an anonymous transfer which does not fit in one datagram.
+	ErrAnonymousMultiFrame = errors.New("udp: anonymous transfers must fit in a single frame")
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Header is the header of a Cyphal/UDP frame.
+type Header struct {
+	Priority canard.Priority
+	// Source and destination node IDs. Unset for anonymous transfers and messages respectively.
+	Source, Destination canard.NodeID
+	TxKind              canard.TxKind
+	Port                canard.PortID
+	TID                 uint64
+	// Index of the frame within its transfer.
+	Index uint32
+	// EOT is set on the last frame of a transfer.
+	EOT      bool
+	UserData uint16
+}
+
+// Put writes the header and its CRC to the first HeaderSize bytes of b.
+func (h *Header) Put(b []byte) {
+	le := binary.LittleEndian
+	b[0] = headerVersion
+	b[1] = byte(h.Priority)
+	le.PutUint16(b[2:], putNodeID(h.Source))
+	le.PutUint16(b[4:], putNodeID(h.Destination))
+	ds := uint16(h.Port)
+	switch h.TxKind {
+	case canard.TxKindRequest:
+		ds = flagServiceNotMessage | flagRequestNotResp | uint16(h.Port)&serviceIDMask
+	case canard.TxKindResponse:
+		ds = flagServiceNotMessage | uint16(h.Port)&serviceIDMask
+	}
+	le.PutUint16(b[6:], ds)
+	le.PutUint64(b[8:], h.TID)
+	index := h.Index
+	if h.EOT {
+		index |= frameIndexEOT
+	}
+	le.PutUint32(b[16:], index)
+	le.PutUint16(b[20:], h.UserData)
+	binary.BigEndian.PutUint16(b[22:], uint16(canard.CRC(0xffff).Add(b[:22])))
+}
+
+// ParseHeader parses the header at the start of datagram b. It returns ErrHeader
+// if the datagram is too short, of another version or its header CRC does not match.
+func ParseHeader(b []byte) (h Header, err error) {
+	if len(b) < HeaderSize || b[0] != headerVersion || canard.CRC(0xffff).Add(b[:HeaderSize]) != 0 {
+		return h, ErrHeader
+	}
+	le := binary.LittleEndian
+	h.Priority = canard.Priority(b[1] & 0x7)
+	h.Source, err = parseNodeID(le.Uint16(b[2:]))
+	if err != nil {
+		return h, err
+	}
+	h.Destination, err = parseNodeID(le.Uint16(b[4:]))
+	if err != nil {
+		return h, err
+	}
+	ds := le.Uint16(b[6:])
+	switch {
+	case ds&flagServiceNotMessage == 0:
+		h.TxKind = canard.TxKindMessage
+		h.Port = canard.PortID(ds)
+		if h.Port > canard.SUBJECT_ID_MAX {
+			return h, ErrHeader
+		}
+	case ds&flagRequestNotResp != 0:
+		h.TxKind = canard.TxKindRequest
+		h.Port = canard.PortID(ds & serviceIDMask)
+	default:
+		h.TxKind = canard.TxKindResponse
+		h.Port = canard.PortID(ds & serviceIDMask)
+	}
+	if h.TxKind != canard.TxKindMessage && h.Port > canard.SERVICE_ID_MAX {
+		return h, ErrHeader
+	}
+	h.TID = le.Uint64(b[8:])
+	index := le.Uint32(b[16:])
+	h.Index = index &^ frameIndexEOT
+	h.EOT = index&frameIndexEOT != 0
+	h.UserData = le.Uint16(b[20:])
+	return h, nil
+}
+
+func putNodeID(n canard.NodeID) uint16 {
+	if n.IsUnset() {
+		return unsetNodeID
+	}
+	return uint16(n)
+}
+
+func parseNodeID(v uint16) (n canard.NodeID, err error) {
+	switch {
+	case v == unsetNodeID:
+		n.Unset()
+	case v <= canard.NODE_ID_MAX:
+		n = canard.NodeID(v)
+	default:
+		return n, canard.ErrInvalidNodeID
+	}
+	return n, nil
+}
+
+// Segment splits a transfer from node src with payload into datagrams of at most mtu
+// bytes of payload each. The transfer CRC follows the payload in the last datagrams.
+// meta.TID is ignored in favor of the 64 bit tid. meta.Remote is the destination of
+// service transfers. If mtu is not positive DefaultMTU is used.
+func Segment(src canard.NodeID, meta *canard.Metadata, tid uint64, payload []byte, mtu int) ([][]byte, error) {
+	switch {
+	case meta == nil:
+		return nil, canard.ErrInvalidArgument
+	case meta.TxKind != canard.TxKindMessage && meta.TxKind != canard.TxKindRequest && meta.TxKind != canard.TxKindResponse:
+		return nil, canard.ErrTransferKind
+	case !src.IsValid() || meta.Priority > canard.PriorityOptional:
+		return nil, canard.ErrInvalidArgument
+	case meta.TxKind == canard.TxKindMessage && meta.Port > canard.SUBJECT_ID_MAX:
+		return nil, canard.ErrInvalidArgument
+	case meta.TxKind != canard.TxKindMessage && (meta.Port > canard.SERVICE_ID_MAX || !meta.Remote.IsSet() || !src.IsSet()):
+		return nil, canard.ErrInvalidArgument
+	}
+	if mtu <= 0 {
+		mtu = DefaultMTU
+	}
+	stream := make([]byte, len(payload)+crcSize)
+	copy(stream, payload)
+	binary.LittleEndian.PutUint32(stream[len(payload):], crc32.Checksum(payload, castagnoli))
+	numFrames := (len(stream) + mtu - 1) / mtu
+	if numFrames > 1 && src.IsUnset() {
+		return nil, ErrAnonymousMultiFrame
+	}
+	h := Header{
+		Priority: meta.Priority,
+		Source:   src,
+		TxKind:   meta.TxKind,
+		Port:     meta.Port,
+		TID:      tid,
+	}
+	h.Destination.Unset()
+	if meta.TxKind != canard.TxKindMessage {
+		h.Destination = meta.Remote
+	}
+	datagrams := make([][]byte, numFrames)
+	for i := range datagrams {
+		chunk := stream[i*mtu:]
+		if len(chunk) > mtu {
+			chunk = chunk[:mtu]
+		}
+		h.Index = uint32(i)
+		h.EOT = i == numFrames-1
+		dg := make([]byte, HeaderSize+len(chunk))
+		h.Put(dg)
+		copy(dg[HeaderSize:], chunk)
+		datagrams[i] = dg
+	}
+	return datagrams, nil
+}
+
+// SubjectGroup returns the multicast group address messages on subject are sent to.
+func SubjectGroup(subject canard.PortID) *net.UDPAddr {
+	return &net.UDPAddr{IP: net.IPv4(239, 0, byte(subject>>8), byte(subject)), Port: Port}
+}
+
+// ServiceGroup returns the multicast group address service transfers to node dst are sent to.
+func ServiceGroup(dst canard.NodeID) *net.UDPAddr {
+	return &net.UDPAddr{IP: net.IPv4(239, 1, 0, byte(dst)), Port: Port}
+}
+
+// GroupAddr returns the multicast group address a transfer with meta is sent to.
+func GroupAddr(meta *canard.Metadata) *net.UDPAddr {
+	if meta.TxKind == canard.TxKindMessage {
+		return SubjectGroup(meta.Port)
+	}
+	return ServiceGroup(meta.Remote)
+}
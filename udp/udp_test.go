@@ -0,0 +1,283 @@
+package udp
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+
+	canard "github.com/soypat/go-canard"
+)
+
+func TestHeader(t *testing.T) {
+	h := Header{
+		Priority:    canard.PrioritySlow,
+		Source:      42,
+		Destination: 7,
+		TxKind:      canard.TxKindRequest,
+		Port:        430,
+		TID:         0x0123456789abcdef,
+		Index:       3,
+		EOT:         true,
+	}
+	var b [HeaderSize]byte
+	h.Put(b[:])
+	want := []byte{
+		1, 6, 42, 0, 7, 0,
+		0xae, 0xc1, // Service request 430.
+		0xef, 0xcd, 0xab, 0x89, 0x67, 0x45, 0x23, 0x01,
+		3, 0, 0, 0x80, // Frame index 3 with EOT.
+		0, 0,
+	}
+	if !bytes.Equal(b[:22], want) {
+		t.Fatalf("got header % x, want % x", b[:22], want)
+	}
+	crc := canard.CRC(0xffff).Add(want)
+	if b[22] != byte(crc>>8) || b[23] != byte(crc) {
+		t.Errorf("got header CRC % x, want %#04x big-endian", b[22:], crc)
+	}
+	got, err := ParseHeader(b[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != h {
+		t.Errorf("got %+v, want %+v", got, h)
+	}
+	for bit := 0; bit < 8*HeaderSize; bit++ {
+		c := b
+		c[bit/8] ^= 1 << (bit % 8)
+		if _, err := ParseHeader(c[:]); err == nil {
+			t.Fatalf("bit %d flipped: header accepted", bit)
+		}
+	}
+	if _, err := ParseHeader(b[:HeaderSize-1]); err != ErrHeader {
+		t.Errorf("short header: got %v, want ErrHeader", err)
+	}
+}
+
+func TestSegmentReassemble(t *testing.T) {
+	const mtu = 16
+	payload := []byte("a transfer spanning several datagrams of sixteen bytes")
+	meta := canard.Metadata{Priority: canard.PriorityNominal, TxKind: canard.TxKindMessage, Port: 1234}
+	datagrams, err := Segment(42, &meta, 1<<40, payload, mtu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (len(payload) + crcSize + mtu - 1) / mtu; len(datagrams) != want {
+		t.Fatalf("got %d datagrams, want %d", len(datagrams), want)
+	}
+	rng := rand.New(rand.NewSource(1))
+	rng.Shuffle(len(datagrams), func(i, j int) { datagrams[i], datagrams[j] = datagrams[j], datagrams[i] })
+	r := NewReassembler(len(payload), 2e6)
+	var tx Transfer
+	for i, dg := range datagrams {
+		err = r.Accept(canard.Microsecond(i), dg, &tx)
+		if i < len(datagrams)-1 && err != canard.ErrTransferPending {
+			t.Fatalf("datagram %d: got %v, want ErrTransferPending", i, err)
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(tx.Payload, payload) {
+		t.Errorf("got payload %q", tx.Payload)
+	}
+	if tx.TID != 1<<40 || tx.Metadata.Port != meta.Port || tx.Metadata.Remote != 42 || !tx.Destination.IsUnset() {
+		t.Errorf("bad transfer %+v", tx)
+	}
+	// Retransmitted frames of a received transfer are duplicates.
+	if err = r.Accept(10, datagrams[0], &tx); err != canard.ErrDuplicateFrame {
+		t.Errorf("got %v, want ErrDuplicateFrame", err)
+	}
+	// Corrupted payload fails the transfer CRC.
+	datagrams, _ = Segment(42, &meta, 1<<40+1, payload, mtu)
+	datagrams[1][HeaderSize] ^= 1
+	for i, dg := range datagrams {
+		err = r.Accept(canard.Microsecond(20+i), dg, &tx)
+	}
+	if err != canard.ErrCRCMismatch {
+		t.Errorf("got %v, want ErrCRCMismatch", err)
+	}
+	// Extent truncates the payload and old transfer-IDs are accepted after the timeout.
+	r.Extent = 4
+	datagrams, _ = Segment(42, &meta, 0, payload, mtu)
+	for _, dg := range datagrams {
+		err = r.Accept(3e6, dg, &tx)
+	}
+	if err != nil || !bytes.Equal(tx.Payload, payload[:4]) {
+		t.Errorf("got %v with payload %q after timeout", err, tx.Payload)
+	}
+}
+
+func TestReassemblerCleanup(t *testing.T) {
+	const mtu, timeout = 100, 1000
+	meta := canard.Metadata{Priority: canard.PriorityNominal, TxKind: canard.TxKindMessage, Port: 1234}
+	payload := make([]byte, 250) // 3 datagrams.
+	r := NewReassembler(len(payload), timeout)
+	r.MaxBuffered = 5 * mtu
+	var tx Transfer
+	// Incomplete transfers of two sources are buffered.
+	for src := canard.NodeID(1); src <= 2; src++ {
+		datagrams, err := Segment(src, &meta, 0, payload, mtu)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, dg := range datagrams[:2] {
+			err = r.Accept(10, dg, &tx)
+			if err != canard.ErrTransferPending {
+				t.Fatal("expected pending transfer, got", err)
+			}
+		}
+	}
+	if sessions, bytes := r.Sessions(); sessions != 2 || bytes != 4*mtu {
+		t.Fatal("expected 2 sessions buffering 4 datagrams, got", sessions, bytes)
+	}
+	// The limit of buffered bytes is reached.
+	datagrams, _ := Segment(3, &meta, 0, payload, mtu)
+	r.Accept(20, datagrams[0], &tx)
+	if err := r.Accept(20, datagrams[1], &tx); err != canard.ErrOutOfMemory {
+		t.Fatal("expected ErrOutOfMemory, got", err)
+	}
+	if _, bytes := r.Sessions(); bytes != 4*mtu {
+		t.Error("expected dropped transfer freed, got bytes", bytes)
+	}
+	// Idle sessions are freed by Accept after the timeout, making room for new transfers.
+	for i, dg := range datagrams {
+		err := r.Accept(20+timeout+1, dg, &tx)
+		if i == len(datagrams)-1 && err != nil {
+			t.Fatal(err)
+		}
+	}
+	if sessions, bytes := r.Sessions(); sessions != 1 || bytes != 0 {
+		t.Error("expected idle sessions freed, got", sessions, bytes)
+	}
+	if sessions, _ := r.CleanupSessions(30 + 2*timeout); sessions != 1 {
+		t.Error("expected remaining session freed, got", sessions)
+	}
+}
+
+func TestSegmentService(t *testing.T) {
+	meta := canard.Metadata{Priority: canard.PriorityFast, TxKind: canard.TxKindResponse, Port: 100, Remote: 7}
+	datagrams, err := Segment(42, &meta, 5, []byte("ok"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tx Transfer
+	err = NewReassembler(8, 1e6).Accept(0, datagrams[0], &tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Metadata.TxKind != canard.TxKindResponse || tx.Destination != 7 || string(tx.Payload) != "ok" {
+		t.Errorf("bad transfer %+v", tx)
+	}
+	anon := canard.Metadata{TxKind: canard.TxKindMessage, Port: 10}
+	_, err = Segment(0xff, &anon, 0, make([]byte, 100), 64)
+	if err != ErrAnonymousMultiFrame {
+		t.Errorf("got %v, want ErrAnonymousMultiFrame", err)
+	}
+	_, err = Segment(0xff, &meta, 0, nil, 0)
+	if err != canard.ErrInvalidArgument {
+		t.Errorf("anonymous service: got %v, want ErrInvalidArgument", err)
+	}
+	bad := meta
+	bad.TxKind = canard.TxKindRequest + 1
+	_, err = Segment(42, &bad, 0, nil, 0)
+	if !errors.Is(err, canard.ErrTransferKind) {
+		t.Errorf("invalid kind: got %v, want ErrTransferKind", err)
+	}
+}
+
+func TestGroups(t *testing.T) {
+	if got := SubjectGroup(8191); !got.IP.Equal(net.IPv4(239, 0, 0x1f, 0xff)) || got.Port != Port {
+		t.Errorf("got subject group %v", got)
+	}
+	if got := ServiceGroup(127); !got.IP.Equal(net.IPv4(239, 1, 0, 127)) || got.Port != Port {
+		t.Errorf("got service group %v", got)
+	}
+}
+
+func TestSocketLoopback(t *testing.T) {
+	listen := func() *Socket {
+		conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Skip(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return NewSocket(conn, 0, 1<<12, 2e6)
+	}
+	a, b := listen(), listen()
+	a.NodeID, b.NodeID = 10, 20
+	a.MTU = 100
+	payload := bytes.Repeat([]byte("loopback "), 50)
+	addr := b.conn.LocalAddr()
+	request := canard.Metadata{Priority: canard.PriorityNominal, TxKind: canard.TxKindRequest, Port: 430, Remote: 20}
+	// Requests to other nodes are discarded by the receiver.
+	other := request
+	other.Remote = 21
+	for _, meta := range []*canard.Metadata{&other, &request} {
+		err := a.SendTo(addr, meta, 1, payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	b.conn.SetReadDeadline(time.Now().Add(time.Second))
+	var tx Transfer
+	err := b.Receive(&tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Metadata.Remote != 10 || tx.Destination != 20 || tx.TID != 1 || !bytes.Equal(tx.Payload, payload) {
+		t.Fatalf("bad transfer from %d to %d tid %d with %d bytes", tx.Metadata.Remote, tx.Destination, tx.TID, len(tx.Payload))
+	}
+	err = b.Receive(&tx)
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("got %v, want timeout", err)
+	}
+}
+
+func TestSocketMulticast(t *testing.T) {
+	lo, err := loopbackInterface()
+	if err != nil {
+		t.Skip(err)
+	}
+	meta := canard.Metadata{Priority: canard.PriorityNominal, TxKind: canard.TxKindMessage, Port: 7509}
+	rconn, err := ListenGroup(lo, SubjectGroup(meta.Port))
+	if err != nil {
+		t.Skip(err)
+	}
+	defer rconn.Close()
+	tconn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Skip(err)
+	}
+	defer tconn.Close()
+	rx := NewSocket(rconn, 0xff, 64, 2e6)
+	tx := NewSocket(tconn, 0xff, 0, 0)
+	if err = tx.Send(&meta, 0, []byte("heartbeat")); err != nil {
+		t.Skip(err)
+	}
+	rconn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	var got Transfer
+	if err = rx.Receive(&got); err != nil {
+		t.Skip("multicast over loopback unavailable: ", err)
+	}
+	if string(got.Payload) != "heartbeat" || !got.Metadata.Remote.IsUnset() {
+		t.Errorf("bad transfer %+v", got)
+	}
+}
+
+func loopbackInterface() (*net.Interface, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	for i := range ifaces {
+		if ifaces[i].Flags&net.FlagLoopback != 0 && ifaces[i].Flags&net.FlagMulticast != 0 {
+			return &ifaces[i], nil
+		}
+	}
+	return nil, errors.New("no multicast loopback interface")
+}